@@ -1,36 +1,228 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-tree/constant"
-	"go-tree/internal"
+	"go-tree/tree"
+	"io"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var flags map[string]interface{}
+var (
+	root         string
+	opts         tree.Options
+	jsonOut      bool
+	xmlOut       bool
+	ndjsonOut    bool
+	yamlOut      bool
+	tomlOut      bool
+	csvOut       bool
+	tsvOut       bool
+	descriptions string
+	dotOut       bool
+	mermaidOut   bool
+	fromFile     string
+	fromJSON     string
+	fromXML      string
+	timeout      time.Duration
+	forceColor   bool
+	noColor      bool
+	unsorted     bool
+)
 
 var goTree = &cobra.Command{
 	Use:   "./main",
 	Short: "unix command \"tree\" implementation in go",
 	Long:  "go-tree is a cli tool which draws a tree of the directory structure",
 	Run: func(cmd *cobra.Command, args []string) {
-		internal.DrawTree(flags)
+		opts.Color = useColor()
+		if descriptions != "" {
+			var err error
+			if opts.Descriptions, err = tree.ReadDescriptions(descriptions); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		if unsorted {
+			opts.Sort = tree.SortNone
+		}
+		// Like tree, the path list may be given as an argument to --fromfile
+		if fromFile == "-" && len(args) > 0 {
+			fromFile = args[0]
+		}
+		if read, input := treeReader(); read != nil {
+			if err := drawFrom(input, read, outputFormat(cmd)); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+		// Interrupting or running out of time prints the tree scanned so far
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		// A second interrupt kills a scan stuck in a slow directory
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if err := tree.DrawContext(ctx, os.Stdout, root, opts, outputFormat(cmd)); err != nil {
+			// Entries that could not be read and truncated scans are already
+			// reported in the tree
+			var partial *tree.PartialTreeError
+			var truncated *tree.TruncatedTreeError
+			if !errors.As(err, &partial) && !errors.As(err, &truncated) {
+				fmt.Println(err)
+			}
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
-	flags = map[string]interface{}{}
-	flags[constant.Root] = goTree.PersistentFlags().StringP(constant.Root, "r", ".", "Root path of the tree")
-	flags[constant.Path] = goTree.PersistentFlags().BoolP(constant.Path, "f", false, "Flag to show fullpaths")
-	flags[constant.Dir] = goTree.PersistentFlags().BoolP(constant.Dir, "d", false, "Flag to only list directories")
-	flags[constant.Level] = goTree.PersistentFlags().IntP(constant.Level, "L", 0, "Max level of tree depth")
-	flags[constant.Permission] = goTree.PersistentFlags().BoolP(constant.Permission, "p", false, "Flag to show permission modes")
-	flags[constant.Time] = goTree.PersistentFlags().BoolP(constant.Time, "t", false, "Flag to sort output by modified time")
-	flags[constant.JSON] = goTree.PersistentFlags().BoolP(constant.JSON, "J", false, "Prints tree in JSON format")
-	flags[constant.XML] = goTree.PersistentFlags().BoolP(constant.XML, "X", false, "Prints tree in XML format")
-	flags[constant.Indent] = goTree.PersistentFlags().BoolP(constant.Indent, "i", false, "Prints tree without indentation lines")
+	goTree.PersistentFlags().StringVarP(&root, constant.Root, "r", ".", "Root path of the tree")
+	goTree.PersistentFlags().StringVar(&fromFile, constant.FromFile, "", "Build the tree from the paths listed in the file, or stdin with \"-\"")
+	goTree.PersistentFlags().Lookup(constant.FromFile).NoOptDefVal = "-"
+	goTree.PersistentFlags().StringVar(&fromJSON, constant.FromJSON, "", "Read a tree saved with -J from the file, or stdin with \"-\"")
+	goTree.PersistentFlags().StringVar(&fromXML, constant.FromXML, "", "Read a tree saved with -X from the file, or stdin with \"-\"")
+	goTree.PersistentFlags().BoolVar(&opts.Archive, constant.Archive, false, "Read the root path as a zip, tar, tar.gz or tar.bz2 archive")
+	goTree.PersistentFlags().IntVar(&opts.Jobs, constant.Jobs, 1, "Number of directories scanned concurrently")
+	goTree.PersistentFlags().DurationVar(&timeout, constant.Timeout, 0, "Stop scanning after the duration, e.g. 30s, and print the tree scanned so far")
+	goTree.PersistentFlags().IntVar(&opts.MaxEntries, constant.MaxEntries, 0, "Stop scanning after listing this many entries")
+	goTree.PersistentFlags().BoolVarP(&opts.All, constant.All, "a", false, "Flag to list hidden files and directories")
+	goTree.PersistentFlags().BoolVarP(&opts.FullPath, constant.Path, "f", false, "Flag to show fullpaths")
+	goTree.PersistentFlags().BoolVarP(&opts.DirsOnly, constant.Dir, "d", false, "Flag to only list directories")
+	goTree.PersistentFlags().BoolVarP(&opts.FollowLinks, constant.Follow, "l", false, "Flag to follow symbolic links to directories")
+	goTree.PersistentFlags().StringVarP(&opts.Pattern, constant.Pattern, "P", "", "List only files matching the pattern, \"|\" separates alternatives")
+	goTree.PersistentFlags().StringVarP(&opts.Exclude, constant.Exclude, "I", "", "Do not list files matching the pattern")
+	goTree.PersistentFlags().BoolVar(&opts.IgnoreCase, constant.IgnoreCase, false, "Ignore case when pattern matching")
+	goTree.PersistentFlags().BoolVar(&opts.MatchDirs, constant.MatchDirs, false, "Include directory names in -P pattern matching")
+	goTree.PersistentFlags().BoolVar(&opts.GitIgnore, constant.GitIgnore, false, "Filter out files ignored by .gitignore files")
+	goTree.PersistentFlags().IntVarP(&opts.Level, constant.Level, "L", 0, "Max level of tree depth")
+	goTree.PersistentFlags().BoolVarP(&opts.Permission, constant.Permission, "p", false, "Flag to show permission modes")
+	goTree.PersistentFlags().BoolVarP(&opts.SortByTime, constant.Time, "t", false, "Flag to sort output by modified time")
+	goTree.PersistentFlags().BoolVarP(&opts.Size, constant.Size, "s", false, "Flag to show the size of each file in bytes")
+	goTree.PersistentFlags().BoolVarP(&opts.Human, constant.Human, "h", false, "Flag to show sizes in human readable format")
+	goTree.PersistentFlags().BoolVar(&opts.SI, constant.SI, false, "Flag to show sizes in human readable format using powers of 1000")
+	goTree.PersistentFlags().BoolVar(&opts.DiskUsage, constant.DiskUsage, false, "Flag to show directory sizes as the accumulation of their contents")
+	goTree.PersistentFlags().BoolVarP(&forceColor, constant.Color, "C", false, "Flag to always colorize output")
+	goTree.PersistentFlags().BoolVarP(&noColor, constant.NoColor, "n", false, "Flag to never colorize output")
+	// -h is taken by --human, so help is only available as --help
+	goTree.PersistentFlags().Bool("help", false, "help for ./main")
+	goTree.PersistentFlags().StringVar(&opts.Sort, constant.Sort, "", "Sort output by name, version, size, mtime, ctime, extension or none")
+	// -r is taken by --root, so reverse is only available as --reverse
+	goTree.PersistentFlags().BoolVar(&opts.Reverse, constant.Reverse, false, "Flag to reverse the sort order")
+	goTree.PersistentFlags().BoolVarP(&unsorted, constant.Unsorted, "U", false, "Flag to leave entries unsorted, in directory order")
+	goTree.PersistentFlags().BoolVar(&opts.DirsFirst, constant.DirsFirst, false, "Flag to list directories before files")
+	goTree.PersistentFlags().BoolVar(&opts.FilesFirst, constant.FilesFirst, false, "Flag to list files before directories")
+	goTree.PersistentFlags().BoolVarP(&jsonOut, constant.JSON, "J", false, "Prints tree in JSON format")
+	goTree.PersistentFlags().BoolVarP(&xmlOut, constant.XML, "X", false, "Prints tree in XML format")
+	goTree.PersistentFlags().BoolVar(&yamlOut, constant.YAML, false, "Prints tree in YAML format")
+	goTree.PersistentFlags().BoolVar(&tomlOut, constant.TOML, false, "Prints tree in TOML format")
+	goTree.PersistentFlags().BoolVar(&csvOut, constant.CSV, false, "Prints a flat CSV listing with one row per entry")
+	goTree.PersistentFlags().BoolVar(&tsvOut, constant.TSV, false, "Prints a flat TSV listing with one row per entry")
+	goTree.PersistentFlags().StringSliceVar(&opts.Columns, constant.Columns, nil, "Columns of the CSV and TSV listings: path, name, depth, type, size, mode, mtime, owner")
+	goTree.PersistentFlags().BoolVar(&opts.CSVSummary, constant.Trailer, false, "Flag to end the CSV and TSV listings with the summary line")
+	goTree.PersistentFlags().StringVar(&opts.MarkdownStyle, constant.Markdown, "", "Prints tree as Markdown, a fenced \"code\" block or a linked \"list\"")
+	goTree.PersistentFlags().Lookup(constant.Markdown).NoOptDefVal = tree.MarkdownCode
+	goTree.PersistentFlags().StringVar(&descriptions, constant.Descriptions, "", "File of \"path: description\" lines annotating the Markdown list")
+	goTree.PersistentFlags().BoolVar(&dotOut, constant.Dot, false, "Prints tree as a Graphviz DOT graph")
+	goTree.PersistentFlags().BoolVar(&mermaidOut, constant.Mermaid, false, "Prints tree as a Mermaid flowchart")
+	goTree.PersistentFlags().StringVar(&opts.Rankdir, constant.Rankdir, "TB", "Direction of the DOT and Mermaid graphs: TB, BT, LR or RL")
+	goTree.PersistentFlags().IntVar(&opts.GraphDepth, constant.GraphDepth, 0, "Max depth drawn in the DOT and Mermaid graphs")
+	goTree.PersistentFlags().BoolVar(&ndjsonOut, constant.NDJSON, false, "Streams one JSON object per entry as newline delimited JSON")
+	goTree.PersistentFlags().StringVarP(&opts.HTMLBase, constant.HTML, "H", "", "Prints tree as an HTML page linking entries relative to the base URL")
+	goTree.PersistentFlags().StringVar(&opts.HTMLTitle, constant.Title, "", "Title of the HTML page")
+	goTree.PersistentFlags().BoolVarP(&opts.NoIndent, constant.Indent, "i", false, "Prints tree without indentation lines")
+}
+
+// Output format selected by the flags, in order of precedence NDJSON,
+// CSV, TSV, DOT, Mermaid, Markdown, HTML, TOML, YAML, XML and JSON
+func outputFormat(cmd *cobra.Command) string {
+	if ndjsonOut {
+		return tree.FormatNDJSON
+	}
+	if csvOut {
+		return tree.FormatCSV
+	}
+	if tsvOut {
+		return tree.FormatTSV
+	}
+	if dotOut {
+		return tree.FormatDot
+	}
+	if mermaidOut {
+		return tree.FormatMermaid
+	}
+	if opts.MarkdownStyle != "" {
+		return tree.FormatMarkdown
+	}
+	if cmd.Flags().Changed(constant.HTML) {
+		return tree.FormatHTML
+	}
+	if tomlOut {
+		return tree.FormatTOML
+	}
+	if yamlOut {
+		return tree.FormatYAML
+	}
+	if xmlOut {
+		return tree.FormatXML
+	}
+	if jsonOut {
+		return tree.FormatJSON
+	}
+	return tree.FormatText
+}
+
+// Reader of the tree given by --fromfile, --fromjson or --fromxml and
+// the file it is read from, nil when the tree is built from the disk
+func treeReader() (func(io.Reader) (*tree.Tree, error), string) {
+	switch {
+	case fromFile != "":
+		return func(r io.Reader) (*tree.Tree, error) { return tree.BuildFromList(r, root, opts) }, fromFile
+	case fromJSON != "":
+		return func(r io.Reader) (*tree.Tree, error) { return tree.ReadJSON(r, opts) }, fromJSON
+	case fromXML != "":
+		return func(r io.Reader) (*tree.Tree, error) { return tree.ReadXML(r, opts) }, fromXML
+	}
+	return nil, ""
+}
+
+// Draws the tree read from the input file, or stdin for "-"
+func drawFrom(input string, read func(io.Reader) (*tree.Tree, error), format string) error {
+	in := os.Stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	t, err := read(in)
+	if err != nil {
+		return err
+	}
+	return tree.Render(os.Stdout, t, format)
+}
+
+// Colorize when forced, otherwise only when writing to a terminal
+func useColor() bool {
+	if noColor {
+		return false
+	}
+	return forceColor || tree.AutoColor(os.Stdout)
 }
 
 func Execute() {
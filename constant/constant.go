@@ -1,13 +1,53 @@
 package constant
 
 const (
-	Root       = "root"
-	Path       = "path"
-	Dir        = "dir"
-	Level      = "level"
-	Permission = "permission"
-	Time       = "time"
-	JSON       = "json"
-	XML        = "xml"
-	Indent     = "indent"
+	Root         = "root"
+	All          = "all"
+	Path         = "path"
+	Dir          = "dir"
+	Level        = "level"
+	Permission   = "permission"
+	Time         = "time"
+	JSON         = "json"
+	XML          = "xml"
+	HTML         = "html"
+	YAML         = "yaml"
+	TOML         = "toml"
+	CSV          = "csv"
+	TSV          = "tsv"
+	Columns      = "columns"
+	Trailer      = "trailer"
+	Markdown     = "markdown"
+	Descriptions = "descriptions"
+	Dot          = "dot"
+	Mermaid      = "mermaid"
+	Rankdir      = "rankdir"
+	GraphDepth   = "graph-depth"
+	FromFile     = "fromfile"
+	FromJSON     = "fromjson"
+	FromXML      = "fromxml"
+	Archive      = "archive"
+	Jobs         = "jobs"
+	Timeout      = "timeout"
+	MaxEntries   = "max-entries"
+	NDJSON       = "ndjson"
+	Title        = "title"
+	Indent       = "indent"
+	Pattern      = "pattern"
+	Exclude      = "exclude"
+	IgnoreCase   = "ignore-case"
+	MatchDirs    = "matchdirs"
+	GitIgnore    = "gitignore"
+	Size         = "size"
+	Human        = "human"
+	SI           = "si"
+	DiskUsage    = "du"
+	Color        = "color"
+	NoColor      = "nocolor"
+	Follow       = "follow"
+	Sort         = "sort"
+	Reverse      = "reverse"
+	Unsorted     = "unsorted"
+	DirsFirst    = "dirsfirst"
+	FilesFirst   = "filesfirst"
 )
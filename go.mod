@@ -2,7 +2,12 @@ module go-tree
 
 go 1.20
 
-require github.com/spf13/cobra v1.7.0
+require (
+	github.com/pelletier/go-toml/v2 v2.0.9
+	github.com/spf13/cobra v1.7.0
+	golang.org/x/sys v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
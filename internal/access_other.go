@@ -0,0 +1,14 @@
+//go:build !unix
+
+package internal
+
+import "os"
+
+// Checks that the directory at path can be listed by opening it
+func canList(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return dir.Close()
+}
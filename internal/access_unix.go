@@ -0,0 +1,19 @@
+//go:build unix
+
+package internal
+
+import (
+	"io/fs"
+
+	"golang.org/x/sys/unix"
+)
+
+// Checks that the directory at path can be listed by the current user,
+// that is read and searched, as decided by the kernel for the user's
+// groups, root and ACLs
+func canList(path string) error {
+	if err := unix.Access(path, unix.R_OK|unix.X_OK); err != nil {
+		return &fs.PathError{Op: "access", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Extensions of the archives listed when given as the root path
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz"}
+
+// Reports if the tree at rootPath is read from an archive, either because
+// it is forced by the options or because the root is a file named like one
+func isArchive(rootPath string, opts Options) bool {
+	if opts.Archive {
+		return true
+	}
+	name := strings.ToLower(rootPath)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			info, err := os.Stat(rootPath)
+			return err == nil && info.Mode().IsRegular()
+		}
+	}
+	return false
+}
+
+// Builds the tree of the entries of the zip, tar, tar.gz or tar.bz2
+// archive at path without extracting it. The format is detected from the
+// contents, directories missing from the archive are inferred from the
+// paths of their entries.
+func BuildArchive(path string, opts Options) (*Tree, error) {
+	return buildArchive(context.Background(), path, opts)
+}
+
+func buildArchive(ctx context.Context, path string, opts Options) (*Tree, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	list := newPathList()
+	in := bufio.NewReader(file)
+	magic, _ := in.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		err = list.addZip(file, info.Size())
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(in); err == nil {
+			err = list.addTar(gz)
+		}
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		err = list.addTar(bzip2.NewReader(in))
+	default:
+		err = list.addTar(in)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return BuildFSContext(ctx, list, path, opts)
+}
+
+// Adds the entries of a tar archive
+func (list *pathList) addTar(r io.Reader) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		info := header.FileInfo()
+		entry := &listEntry{mode: info.Mode(), size: info.Size(), modTime: info.ModTime()}
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			entry.target = header.Linkname
+		case tar.TypeXGlobalHeader:
+			continue
+		}
+		list.add(header.Name, entry)
+	}
+}
+
+// Adds the entries of a zip archive of the given size
+func (list *pathList) addZip(r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range archive.File {
+		info := file.FileInfo()
+		entry := &listEntry{mode: info.Mode(), size: info.Size(), modTime: info.ModTime()}
+		// The target of a link is stored as its contents
+		if entry.mode&fs.ModeSymlink != 0 {
+			if entry.target, err = readZipLink(file); err != nil {
+				return err
+			}
+		}
+		list.add(file.Name, entry)
+	}
+	return nil
+}
+
+func readZipLink(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	return string(target), err
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// Reasons for a scan to stop before the whole tree is listed
+const (
+	TruncatedInterrupted = "interrupted"
+	TruncatedTimeout     = "timeout"
+	TruncatedMaxEntries  = "max-entries"
+)
+
+// Budget of a scan shared by all the workers building a tree
+type budget struct {
+	ctx context.Context
+	mu  sync.Mutex
+	// Entries listed so far
+	entries int
+	// Reason the scan stopped, empty while it goes on
+	reason string
+}
+
+func newBudget(ctx context.Context) *budget {
+	return &budget{ctx: ctx}
+}
+
+// Reports if the scan has to stop, recording why when the context is done
+func (bu *budget) stopped() bool {
+	err := bu.ctx.Err()
+	if err == nil {
+		return false
+	}
+	reason := TruncatedInterrupted
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = TruncatedTimeout
+	}
+	bu.stop(reason)
+	return true
+}
+
+// Records the first reason the scan stopped
+func (bu *budget) stop(reason string) {
+	bu.mu.Lock()
+	defer bu.mu.Unlock()
+	if bu.reason == "" {
+		bu.reason = reason
+	}
+}
+
+// Reason the scan stopped, empty if the tree is complete
+func (bu *budget) truncated() string {
+	bu.mu.Lock()
+	defer bu.mu.Unlock()
+	return bu.reason
+}
+
+// Keeps as many of the entries of a directory as the max number of
+// entries allows
+func (bu *budget) take(files []fs.DirEntry, maxEntries int) []fs.DirEntry {
+	if maxEntries <= 0 {
+		return files
+	}
+	bu.mu.Lock()
+	defer bu.mu.Unlock()
+	remaining := maxEntries - bu.entries
+	if remaining < len(files) {
+		if remaining < 0 {
+			remaining = 0
+		}
+		files = files[:remaining]
+		if bu.reason == "" {
+			bu.reason = TruncatedMaxEntries
+		}
+	}
+	bu.entries += len(files)
+	return files
+}
+
+// Keeps the files of a directory and as many of its subdirectories as the
+// max number of entries allows, when only the directories are listed
+func (bu *budget) takeDirs(files []fs.DirEntry, maxEntries int) []fs.DirEntry {
+	kept := len(bu.take(justDirs(files), maxEntries))
+	result := []fs.DirEntry{}
+	for _, file := range files {
+		if file.IsDir() {
+			if kept == 0 {
+				continue
+			}
+			kept--
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// Marker printed after the summary of a truncated tree
+func truncationMarker(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case TruncatedInterrupted:
+		return "[scan interrupted]"
+	case TruncatedTimeout:
+		return "[scan timed out]"
+	case TruncatedMaxEntries:
+		return "[scan stopped at max entries]"
+	}
+	return fmt.Sprintf("[scan stopped: %s]", reason)
+}
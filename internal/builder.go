@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+// Holds the state shared while building a single tree
+type builder struct {
+	// File system the tree is read from, rooted at root
+	fsys    fs.FS
+	root    string
+	absRoot string
+	opts    Options
+	summary *TreeSummary
+	include *pattern
+	exclude *pattern
+	// Cancellation and max entries of the scan
+	budget *budget
+	// Slots of the workers building subdirectories concurrently, nil when
+	// the tree is built serially
+	workers chan struct{}
+	// Called with each entry as soon as it is discovered. The entries are
+	// not kept in the tree when set.
+	visit func(node *TreeNode) error
+	// Called with each entry that could not be read, when set
+	failed func(node *TreeNode) error
+}
+
+func newBuilder(ctx context.Context, fsys fs.FS, root string, opts Options, summary *TreeSummary) (*builder, error) {
+	b := &builder{
+		fsys:    fsys,
+		root:    root,
+		opts:    opts,
+		summary: summary,
+		budget:  newBudget(ctx),
+	}
+	// The calling goroutine is one of the workers. The max entries go to
+	// the first entries in depth first order, so the scan is then serial.
+	if opts.Jobs > 1 && opts.MaxEntries <= 0 {
+		b.workers = make(chan struct{}, opts.Jobs-1)
+	}
+	if err := validateSort(opts.sortOrder()); err != nil {
+		return nil, err
+	}
+	var err error
+	if opts.Pattern != "" {
+		if b.include, err = compilePattern(opts.Pattern, opts.IgnoreCase); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Exclude != "" {
+		if b.exclude, err = compilePattern(opts.Exclude, opts.IgnoreCase); err != nil {
+			return nil, err
+		}
+	}
+	if b.absRoot, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Lists the entries of the directory at path, in directory order when
+// the file system allows it
+func (b *builder) readDir(path string) ([]fs.DirEntry, error) {
+	name := b.fsPath(path)
+	dir, err := b.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	if dir, ok := dir.(fs.ReadDirFile); ok {
+		return dir.ReadDir(-1)
+	}
+	return fs.ReadDir(b.fsys, name)
+}
+
+// Reads the target of the symbolic link at path and its info, nil if the
+// link is broken. Links are not read when the file system cannot.
+func (b *builder) readLink(path string) (string, fs.FileInfo) {
+	fsys, ok := b.fsys.(readLinkFS)
+	if !ok {
+		return "", nil
+	}
+	target, err := fsys.ReadLink(b.fsPath(path))
+	if err != nil {
+		return "", nil
+	}
+	info, _ := fs.Stat(b.fsys, b.fsPath(path))
+	return target, info
+}
+
+// A subdirectory built by a worker, counted into a summary of its own
+// until it is collected
+type job struct {
+	summary TreeSummary
+	err     error
+}
+
+// Runs build on a free worker, or in the calling goroutine when all the
+// workers are busy
+func (b *builder) run(wg *sync.WaitGroup, j *job, build func(b *builder) error) {
+	select {
+	case b.workers <- struct{}{}:
+		worker := *b
+		worker.summary = &j.summary
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-b.workers }()
+			j.err = build(&worker)
+		}()
+	default:
+		j.err = build(b)
+	}
+}
+
+// Checks that the directory at path can be listed. Directories on the
+// disk are checked with access(2), other file systems are only known once
+// the directory is opened.
+func (b *builder) canList(path string) error {
+	if _, disk := b.fsys.(diskFS); disk {
+		return canList(path)
+	}
+	return nil
+}
+
+// Records the error of an entry that could not be read, before the entry
+// is visited
+func (b *builder) record(node *TreeNode, op string, err error) {
+	node.Err = &EntryError{Op: op, Err: err}
+	b.summary.Errors++
+}
+
+// Records the error of an entry that was already visited, such as a
+// directory that fails to open
+func (b *builder) fail(node *TreeNode, op string, err error) error {
+	b.record(node, op, err)
+	if b.failed != nil {
+		return b.failed(node)
+	}
+	return nil
+}
+
+// Adds the counts of a finished job to the summary
+func (b *builder) collect(j *job) error {
+	b.summary.Directories += j.summary.Directories
+	b.summary.Files += j.summary.Files
+	b.summary.Size += j.summary.Size
+	b.summary.Errors += j.summary.Errors
+	return j.err
+}
+
+// State inherited by a directory from its ancestors
+type dirScope struct {
+	// An ancestor directory matched the -P pattern
+	matched bool
+	// Gitignore files in effect, from the lowest to the highest precedence
+	ignores []*gitignore
+	// Directories from the root down to this one, tracked when following
+	// symbolic links to detect cycles
+	ancestors []fs.FileInfo
+}
+
+// Scope of the tree root, including the gitignore files of an enclosing
+// repository
+func (b *builder) rootScope(info fs.FileInfo) (dirScope, error) {
+	scope := dirScope{}
+	if b.opts.FollowLinks {
+		scope.ancestors = []fs.FileInfo{info}
+	}
+	// Only the disk has directories above the root
+	if _, disk := b.fsys.(diskFS); disk && b.opts.GitIgnore {
+		ignores, err := loadParentGitignores(b.absRoot)
+		if err != nil {
+			return scope, err
+		}
+		scope.ignores = ignores
+	}
+	return scope, nil
+}
+
+// Scope for the contents of the directory at path
+func (b *builder) enterDir(path string, scope dirScope) (dirScope, error) {
+	if !b.opts.GitIgnore {
+		return scope, nil
+	}
+	loaded, err := loadGitignores(b.fsys, b.fsPath(path), b.absPath(path))
+	if err != nil || len(loaded) == 0 {
+		return scope, err
+	}
+	ignores := make([]*gitignore, 0, len(scope.ignores)+len(loaded))
+	ignores = append(ignores, scope.ignores...)
+	scope.ignores = append(ignores, loaded...)
+	return scope, nil
+}
+
+// Slash separated path of an entry relative to the tree root
+func (b *builder) relPath(path string) string {
+	rel, err := filepath.Rel(b.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Name of an entry in the file system of the tree
+func (b *builder) fsPath(path string) string {
+	return b.relPath(path)
+}
+
+// Absolute path of an entry below the tree root
+func (b *builder) absPath(path string) string {
+	return filepath.Join(b.absRoot, filepath.FromSlash(b.relPath(path)))
+}
+
+// Drops the entries ignored by the gitignore files in scope
+func (b *builder) filterGitignored(dirPath string, files []fs.DirEntry, scope dirScope) []fs.DirEntry {
+	if len(scope.ignores) == 0 {
+		return files
+	}
+	result := []fs.DirEntry{}
+	for _, file := range files {
+		if isGitignored(scope.ignores, b.absPath(filepath.Join(dirPath, file.Name())), file.IsDir()) {
+			continue
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// Drops the entries of dirPath rejected by the -P and -I patterns.
+// Directories are only matched against -P when MatchDirs is set, and
+// everything below a matched directory is listed.
+func (b *builder) filterPatterns(dirPath string, files []fs.DirEntry, scope dirScope) []fs.DirEntry {
+	if b.include == nil && b.exclude == nil {
+		return files
+	}
+	result := []fs.DirEntry{}
+	for _, file := range files {
+		rel := b.relPath(filepath.Join(dirPath, file.Name()))
+		if b.exclude != nil && b.exclude.match(rel) {
+			continue
+		}
+		if b.include != nil && !scope.matched && !file.IsDir() && !b.include.match(rel) {
+			continue
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// Scope passed from a directory to its subdirectory. Everything below a
+// directory matching the -P pattern is listed.
+func (b *builder) childScope(child *TreeNode, scope dirScope) dirScope {
+	if !scope.matched && b.include != nil && b.opts.MatchDirs {
+		scope.matched = b.include.match(b.relPath(child.Path))
+	}
+	if b.opts.FollowLinks {
+		ancestors := make([]fs.FileInfo, 0, len(scope.ancestors)+1)
+		ancestors = append(ancestors, scope.ancestors...)
+		scope.ancestors = append(ancestors, child.resolvedInfo())
+	}
+	return scope
+}
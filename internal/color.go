@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Colors used when LS_COLORS is not set
+const defaultLSColors = "no=00:fi=00:di=01;34:ln=01;36:pi=40;33:so=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:ex=01;32:" +
+	"*.tar=01;31:*.tgz=01;31:*.gz=01;31:*.bz2=01;31:*.xz=01;31:*.zip=01;31:*.7z=01;31:" +
+	"*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.png=01;35:*.svg=01;35:*.mp3=00;36:*.mp4=01;35"
+
+// Escape sequences for each kind of entry, parsed from LS_COLORS
+type lsColors struct {
+	types map[string]string
+	// Suffixes of "*.ext" entries in the order they were defined
+	suffixes []lsColorSuffix
+}
+
+type lsColorSuffix struct {
+	suffix string
+	code   string
+}
+
+// Parses a LS_COLORS value, falling back to the built-in colors if empty
+func parseLSColors(env string) *lsColors {
+	if env == "" {
+		env = defaultLSColors
+	}
+	colors := &lsColors{types: map[string]string{}}
+	for _, entry := range strings.Split(env, ":") {
+		key, code, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			continue
+		}
+		if strings.HasPrefix(key, "*") {
+			colors.suffixes = append(colors.suffixes, lsColorSuffix{suffix: key[1:], code: code})
+		} else {
+			colors.types[key] = code
+		}
+	}
+	return colors
+}
+
+// Colors loaded from the LS_COLORS environment variable
+func loadLSColors() *lsColors {
+	return parseLSColors(os.Getenv("LS_COLORS"))
+}
+
+// Reports if output written to w should be colorized when no color mode
+// is forced: w must be a terminal and NO_COLOR must not be set
+func AutoColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&fs.ModeCharDevice != 0
+}
+
+// Wraps name in the color of the entry of node
+func (colors *lsColors) paint(name string, node *TreeNode) string {
+	code := colors.code(node.Info, node.TargetInfo)
+	if code == "" || code == "0" || code == "00" {
+		return name
+	}
+	return "\x1b[" + code + "m" + name + "\x1b[0m"
+}
+
+// Color code of an entry, target being the info of a symbolic link
+// target as resolved in the file system of the tree, nil if it is broken
+func (colors *lsColors) code(info fs.FileInfo, target fs.FileInfo) string {
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		return colors.types["di"]
+	case mode&fs.ModeSymlink != 0:
+		if target == nil {
+			if code, ok := colors.types["or"]; ok {
+				return code
+			}
+			return colors.types["ln"]
+		}
+		if colors.types["ln"] == "target" {
+			return colors.code(target, nil)
+		}
+		return colors.types["ln"]
+	case mode&fs.ModeNamedPipe != 0:
+		return colors.types["pi"]
+	case mode&fs.ModeSocket != 0:
+		return colors.types["so"]
+	case mode&fs.ModeCharDevice != 0:
+		return colors.types["cd"]
+	case mode&fs.ModeDevice != 0:
+		return colors.types["bd"]
+	case mode&0111 != 0:
+		if code, ok := colors.types["ex"]; ok {
+			return code
+		}
+	}
+	// Later definitions take precedence over earlier ones
+	name := info.Name()
+	for i := len(colors.suffixes) - 1; i >= 0; i-- {
+		if strings.HasSuffix(name, colors.suffixes[i].suffix) {
+			return colors.suffixes[i].code
+		}
+	}
+	return colors.types["fi"]
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Columns accepted by Options.Columns
+const (
+	ColumnPath  = "path"
+	ColumnName  = "name"
+	ColumnDepth = "depth"
+	ColumnType  = "type"
+	ColumnSize  = "size"
+	ColumnMode  = "mode"
+	ColumnMtime = "mtime"
+	ColumnOwner = "owner"
+)
+
+// Columns of the CSV and TSV outputs when none are selected
+var defaultColumns = []string{ColumnPath, ColumnDepth, ColumnType, ColumnSize, ColumnMode, ColumnMtime}
+
+func validateColumns(columns []string) error {
+	for _, column := range columns {
+		switch column {
+		case ColumnPath, ColumnName, ColumnDepth, ColumnType, ColumnSize, ColumnMode, ColumnMtime, ColumnOwner:
+		default:
+			return fmt.Errorf("unknown column %q", column)
+		}
+	}
+	return nil
+}
+
+// Prints the entries as a flat table with a header row, one row per
+// entry, separated by comma or tab
+func (t *Tree) printCsvTree(out io.Writer, comma rune) error {
+	columns := t.Options.Columns
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	if err := validateColumns(columns); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Comma = comma
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	owners := map[uint32]string{}
+	if err := t.Root.writeCsvRows(writer, columns, owners); err != nil {
+		return err
+	}
+	// Summary trailer padded to the width of the table
+	if t.Options.CSVSummary {
+		row := make([]string, len(columns))
+		row[0] = t.summaryLine()
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes the row of the node followed by the rows of its children
+func (node *TreeNode) writeCsvRows(writer *csv.Writer, columns []string, owners map[uint32]string) error {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = node.csvField(column, owners)
+	}
+	if err := writer.Write(row); err != nil {
+		return err
+	}
+	for i := range node.Children {
+		if err := node.Children[i].writeCsvRows(writer, columns, owners); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (node *TreeNode) csvField(column string, owners map[uint32]string) string {
+	switch column {
+	case ColumnPath:
+		return node.Path
+	case ColumnName:
+		return node.Info.Name()
+	case ColumnDepth:
+		return strconv.Itoa(node.Depth)
+	case ColumnType:
+		return getFileType(node.Info)
+	case ColumnSize:
+		return strconv.FormatInt(node.Size, 10)
+	case ColumnMode:
+		return fmt.Sprintf("%04o", node.Info.Mode().Perm())
+	case ColumnMtime:
+		return node.Info.ModTime().Format(time.RFC3339)
+	case ColumnOwner:
+		return fileOwner(node.Info, owners)
+	}
+	return ""
+}
@@ -0,0 +1,15 @@
+package internal
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// Time of the last status change of a file
+func changeTime(info fs.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Ctimespec.Unix())
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package internal
+
+import (
+	"io/fs"
+	"time"
+)
+
+// Time of the last status change of a file, the modification time where
+// the change time is not available
+func changeTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
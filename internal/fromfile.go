@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry of a tree that is not read from the disk. It serves as its own
+// file info, holding whatever a path list or archive header tells.
+type listEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	// Target of a symbolic link
+	target string
+}
+
+func (e *listEntry) Name() string               { return e.name }
+func (e *listEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *listEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *listEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *listEntry) Size() int64                { return e.size }
+func (e *listEntry) Mode() fs.FileMode          { return e.mode }
+func (e *listEntry) ModTime() time.Time         { return e.modTime }
+func (e *listEntry) Sys() interface{}           { return nil }
+
+// Modes of the entries whose mode is not known
+const (
+	listDirMode  = fs.ModeDir | 0755
+	listFileMode = 0644
+)
+
+// File system of a tree that is not read from the disk, listing the
+// entries of a path list or archive. Files have no contents.
+type pathList struct {
+	// Entries of each directory, keyed by directory name
+	dirs map[string][]fs.DirEntry
+	// Every entry, keyed by name
+	entries map[string]*listEntry
+}
+
+func newPathList() *pathList {
+	return &pathList{
+		dirs:    map[string][]fs.DirEntry{".": nil},
+		entries: map[string]*listEntry{".": {name: ".", mode: listDirMode}},
+	}
+}
+
+// Infers the directories from slash separated paths. A trailing slash
+// marks a directory, as do the parents of every path.
+func listPaths(paths []string) *pathList {
+	list := newPathList()
+	for _, p := range paths {
+		entry := &listEntry{mode: listFileMode}
+		if strings.HasSuffix(p, "/") {
+			entry.mode = listDirMode
+		}
+		list.add(p, entry)
+	}
+	return list
+}
+
+// Adds the entry at the slash separated path p along with its parent
+// directories. Entries keep the order in which they were first listed,
+// and a later entry for the same path replaces the known info.
+func (list *pathList) add(p string, entry *listEntry) {
+	p = strings.TrimLeft(path.Clean("/"+p), "/")
+	if p == "" {
+		return
+	}
+	parent := "."
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		name := path.Join(parent, part)
+		existing, ok := list.entries[name]
+		if !ok {
+			existing = &listEntry{name: part, mode: listDirMode}
+			list.entries[name] = existing
+			list.dirs[parent] = append(list.dirs[parent], existing)
+		}
+		if i+1 == len(parts) {
+			wasDir := ok && existing.IsDir()
+			*existing = *entry
+			existing.name = part
+			// A path listed as a file may also have entries below it
+			if wasDir && !existing.IsDir() {
+				existing.mode = listDirMode
+			}
+		} else if !existing.IsDir() {
+			existing.mode = listDirMode
+		}
+		parent = name
+	}
+}
+
+// Maximum number of links resolved in a row, as in the kernel
+const maxLinkHops = 40
+
+// Name and entry of name with links resolved, nil if the name is
+// missing, points outside the list or is part of a cycle
+func (list *pathList) resolve(name string, hops int) (string, *listEntry) {
+	entry, ok := list.entries[name]
+	if !ok || hops > maxLinkHops {
+		return "", nil
+	}
+	if entry.mode&fs.ModeSymlink == 0 {
+		return name, entry
+	}
+	// Targets outside the list are not among the entries
+	if path.IsAbs(entry.target) {
+		return "", nil
+	}
+	return list.resolve(path.Join(path.Dir(name), entry.target), hops+1)
+}
+
+// Opens the entry listed as name. Names are looked up as listed rather
+// than checked with fs.ValidPath, since archives and path lists may hold
+// names that are not valid UTF-8.
+func (list *pathList) Open(name string) (fs.File, error) {
+	resolved, entry := list.resolve(name, 0)
+	if entry == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &listFile{entry: entry, entries: list.dirs[resolved]}, nil
+}
+
+func (list *pathList) Stat(name string) (fs.FileInfo, error) {
+	_, entry := list.resolve(name, 0)
+	if entry == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+func (list *pathList) ReadLink(name string) (string, error) {
+	entry, ok := list.entries[name]
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return entry.target, nil
+}
+
+// An open entry of a path list
+type listFile struct {
+	entry *listEntry
+	// Entries of a directory not read yet
+	entries []fs.DirEntry
+}
+
+func (f *listFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *listFile) Close() error               { return nil }
+
+func (f *listFile) Read(b []byte) (int, error) {
+	if f.entry.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: fs.ErrInvalid}
+	}
+	return 0, io.EOF
+}
+
+func (f *listFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.entry.name, Err: fs.ErrInvalid}
+	}
+	if n > 0 && len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := append([]fs.DirEntry{}, f.entries[:n]...)
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+// Reads newline separated paths, or NUL separated ones when the input
+// contains a NUL byte as printed by find -print0
+func ReadPathList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+	paths := []string{}
+	for _, line := range bytes.Split(data, sep) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > 0 {
+			paths = append(paths, filepath.ToSlash(string(line)))
+		}
+	}
+	return paths, nil
+}
+
+// Builds the tree rooted at rootPath from the paths read from r, as
+// listed by git ls-files, find or tar -t, without touching the disk
+func BuildFromList(r io.Reader, rootPath string, opts Options) (*Tree, error) {
+	paths, err := ReadPathList(r)
+	if err != nil {
+		return nil, err
+	}
+	return BuildFSContext(context.Background(), listPaths(paths), rootPath, opts)
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// File system that can read the targets of symbolic links
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// The directory at root on the disk. Unlike os.DirFS it reads links, the
+// gitignore files of an enclosing repository can be found above it, and
+// names need not be valid UTF-8 since the disk allows any bytes in them.
+type diskFS struct {
+	root string
+}
+
+func newDiskFS(root string) diskFS {
+	return diskFS{root: root}
+}
+
+func (fsys diskFS) path(name string) string {
+	return filepath.Join(fsys.root, filepath.FromSlash(name))
+}
+
+// Opens name without checking it with fs.ValidPath, which rejects names
+// that are not valid UTF-8
+func (fsys diskFS) Open(name string) (fs.File, error) {
+	file, err := os.Open(fsys.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (fsys diskFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(fsys.path(name))
+}
+
+func (fsys diskFS) ReadLink(name string) (string, error) {
+	return os.Readlink(fsys.path(name))
+}
+
+// Builds the tree of the file system fsys, whose root directory is named
+// rootPath in the output
+func BuildFS(fsys fs.FS, rootPath string, opts Options) (*Tree, error) {
+	return BuildFSContext(context.Background(), fsys, rootPath, opts)
+}
+
+// Builds the tree of the file system fsys until ctx is done, returning
+// the tree scanned so far flagged as truncated
+func BuildFSContext(ctx context.Context, fsys fs.FS, rootPath string, opts Options) (*Tree, error) {
+	// Links back to an ancestor are only detected on the disk, where the
+	// same directory can be told by os.SameFile
+	if _, disk := fsys.(diskFS); !disk {
+		opts.FollowLinks = false
+	}
+	info, err := isValidFS(fsys, rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rootNode := NewTreeNode(nil, nil, 0, false, rootPath, info)
+	summary := NewTreeSummary(1, 0)
+	tree := NewTree(rootNode, opts, summary)
+	b, err := newBuilder(ctx, fsys, rootPath, opts, &tree.Summary)
+	if err != nil {
+		return nil, err
+	}
+	if err := tree.Root.build(b); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// Rules of a single .gitignore or exclude file, scoped to the directory
+// it applies to
+type gitignore struct {
+	// Absolute path of the directory the patterns are relative to
+	base  string
+	rules []gitignoreRule
+}
+
+type gitignoreRule struct {
+	re *regexp.Regexp
+	// Pattern starts with "!" and re-includes matches
+	negate bool
+	// Pattern ends with "/" and only matches directories
+	dirOnly bool
+	// Pattern contains a "/" and is matched against the path relative
+	// to base instead of the base name
+	anchored bool
+}
+
+// Parses the gitignore file at path, returning nil if it does not exist
+// or holds no rules
+func readGitignore(fsys fs.FS, name string, base string) (*gitignore, error) {
+	file, err := fsys.Open(name)
+	if isMissing(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ignore := &gitignore{base: base}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rule, ok, err := parseGitignoreLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ignore.rules = append(ignore.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ignore.rules) == 0 {
+		return nil, nil
+	}
+	return ignore, nil
+}
+
+func parseGitignoreLine(line string) (gitignoreRule, bool, error) {
+	rule := gitignoreRule{}
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false, nil
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	re, err := globToRegexp(line, false)
+	if err != nil {
+		return rule, false, err
+	}
+	rule.re = re
+	return rule, true, nil
+}
+
+// Reports if the entry at the absolute path is ignored by the stack of
+// gitignore files, ordered from the lowest to the highest precedence.
+// The last matching rule of the most specific file decides.
+func isGitignored(ignores []*gitignore, absPath string, isDir bool) bool {
+	name := filepath.Base(absPath)
+	for i := len(ignores) - 1; i >= 0; i-- {
+		ignore := ignores[i]
+		rel, err := filepath.Rel(ignore.base, absPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for j := len(ignore.rules) - 1; j >= 0; j-- {
+			rule := ignore.rules[j]
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			subject := name
+			if rule.anchored {
+				subject = rel
+			}
+			if rule.re.MatchString(subject) {
+				return !rule.negate
+			}
+		}
+	}
+	return false
+}
+
+// Reports if err means that a file is missing, including a path going
+// through a file as if it were a directory
+func isMissing(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// Loads the gitignore files that apply to the contents of the directory
+// dir of fsys: for a repository root its info/exclude, then its own
+// .gitignore
+func loadGitignores(fsys fs.FS, dir string, absDir string) ([]*gitignore, error) {
+	ignores := []*gitignore{}
+	exclude, err := readGitExclude(fsys, dir, absDir)
+	if err != nil {
+		return nil, err
+	}
+	if exclude != nil {
+		ignores = append(ignores, exclude)
+	}
+	ignore, err := readGitignore(fsys, path.Join(dir, ".gitignore"), absDir)
+	if err != nil {
+		return nil, err
+	}
+	if ignore != nil {
+		ignores = append(ignores, ignore)
+	}
+	return ignores, nil
+}
+
+// Parses the info/exclude file of the repository whose working tree is
+// the directory dir of fsys. Submodules and worktrees have a .git file
+// pointing to the repository instead of a .git directory, which is only
+// followed on the disk.
+func readGitExclude(fsys fs.FS, dir string, absDir string) (*gitignore, error) {
+	info, err := fs.Stat(fsys, path.Join(dir, ".git"))
+	if isMissing(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readGitignore(fsys, path.Join(dir, ".git", "info", "exclude"), absDir)
+	}
+	if _, disk := fsys.(diskFS); !disk {
+		return nil, nil
+	}
+	gitDir, err := gitCommonDir(filepath.Join(absDir, ".git"))
+	if err != nil || gitDir == "" {
+		return nil, err
+	}
+	return readGitignore(newDiskFS(gitDir), "info/exclude", absDir)
+}
+
+// Directory of the repository that the .git file at gitFile points to
+// with its "gitdir:" line, empty if it points nowhere. Worktrees share
+// the info directory of the main repository, found through commondir.
+func gitCommonDir(gitFile string) (string, error) {
+	data, err := os.ReadFile(gitFile)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(line), "gitdir:")
+	if !ok {
+		return "", nil
+	}
+	gitDir = relativeTo(filepath.Dir(gitFile), strings.TrimSpace(gitDir))
+	common, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if isMissing(err) {
+		return gitDir, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return relativeTo(gitDir, strings.TrimSpace(string(common))), nil
+}
+
+// Path p, resolved against dir when it is relative
+func relativeTo(dir string, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, filepath.FromSlash(p))
+}
+
+// Loads the gitignore files of the enclosing repository that apply to
+// absRoot, from the repository root down to the parent of absRoot
+func loadParentGitignores(absRoot string) ([]*gitignore, error) {
+	if _, err := os.Stat(filepath.Join(absRoot, ".git")); err == nil {
+		// The root is a repository of its own
+		return nil, nil
+	}
+	parents := []string{}
+	for dir := filepath.Dir(absRoot); ; dir = filepath.Dir(dir) {
+		parents = append(parents, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			// Not inside a repository
+			return nil, nil
+		}
+	}
+
+	ignores := []*gitignore{}
+	for i := len(parents) - 1; i >= 0; i-- {
+		loaded, err := loadGitignores(newDiskFS(parents[i]), ".", parents[i])
+		if err != nil {
+			return nil, err
+		}
+		ignores = append(ignores, loaded...)
+	}
+	return ignores, nil
+}
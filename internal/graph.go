@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Default direction of the graph outputs, top to bottom
+const defaultRankdir = "TB"
+
+// Graph direction selected by the options
+func (opts Options) rankdir() (string, error) {
+	switch rankdir := strings.ToUpper(opts.Rankdir); rankdir {
+	case "":
+		return defaultRankdir, nil
+	case "TB", "BT", "LR", "RL":
+		return rankdir, nil
+	}
+	return "", fmt.Errorf("unknown rankdir %q, expected TB, BT, LR or RL", opts.Rankdir)
+}
+
+// Reports if a node at depth is drawn in the graph outputs
+func (opts Options) inGraph(depth int) bool {
+	return opts.GraphDepth == 0 || depth <= opts.GraphDepth
+}
+
+// Prints the directory tree as a Graphviz DOT digraph: directories are
+// boxes, files are notes and links are reached through dashed edges
+func (t *Tree) printDotTree(out *bytes.Buffer) error {
+	rankdir, err := t.Options.rankdir()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "digraph tree {\n")
+	fmt.Fprintf(out, "  rankdir=%s;\n", rankdir)
+	fmt.Fprintf(out, "  node [fontname=\"monospace\"];\n")
+	id := 0
+	t.Root.drawdot(&id, t.Options, out)
+	if t.Summary.Truncated != "" {
+		fmt.Fprintf(out, "  // %s\n", truncationMarker(t.Summary.Truncated))
+	}
+	fmt.Fprintf(out, "}\n")
+	return nil
+}
+
+// Prints the node and the edges to its children, returning its id
+func (node *TreeNode) drawdot(id *int, opts Options, out *bytes.Buffer) int {
+	nodeID := *id
+	*id++
+	shape := "note"
+	if node.resolvedInfo().IsDir() {
+		shape = "box"
+	}
+	fmt.Fprintf(out, "  n%d [label=%s, shape=%s];\n", nodeID, dotQuote(node.graphLabel(opts)), shape)
+	for _, child := range node.Children {
+		if !opts.inGraph(child.Depth) {
+			continue
+		}
+		childID := child.drawdot(id, opts, out)
+		style := ""
+		if child.isLink() {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(out, "  n%d -> n%d%s;\n", nodeID, childID, style)
+	}
+	return nodeID
+}
+
+// Prints the directory tree as a Mermaid flowchart: directories are
+// boxes, files are flags and links are reached through dotted edges
+func (t *Tree) printMermaidTree(out *bytes.Buffer) error {
+	rankdir, err := t.Options.rankdir()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "graph %s\n", rankdir)
+	id := 0
+	t.Root.drawmermaid(&id, t.Options, out)
+	if t.Summary.Truncated != "" {
+		fmt.Fprintf(out, "  %%%% %s\n", truncationMarker(t.Summary.Truncated))
+	}
+	return nil
+}
+
+func (node *TreeNode) drawmermaid(id *int, opts Options, out *bytes.Buffer) int {
+	nodeID := *id
+	*id++
+	label := mermaidQuote(node.graphLabel(opts))
+	if node.resolvedInfo().IsDir() {
+		fmt.Fprintf(out, "  n%d[%s]\n", nodeID, label)
+	} else {
+		fmt.Fprintf(out, "  n%d>%s]\n", nodeID, label)
+	}
+	for _, child := range node.Children {
+		if !opts.inGraph(child.Depth) {
+			continue
+		}
+		childID := child.drawmermaid(id, opts, out)
+		edge := "-->"
+		if child.isLink() {
+			edge = "-.->"
+		}
+		fmt.Fprintf(out, "  n%d %s n%d\n", nodeID, edge, childID)
+	}
+	return nodeID
+}
+
+// Label of a graph node, links show their target
+func (node *TreeNode) graphLabel(opts Options) string {
+	label := node.displayName(opts)
+	if node.isLink() && node.Target != "" {
+		label = fmt.Sprintf("%s -> %s", label, node.Target)
+	}
+	return label
+}
+
+// Quotes a DOT string
+func dotQuote(text string) string {
+	return "\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text) + "\""
+}
+
+// Quotes a Mermaid label, using entity codes for the characters that
+// cannot appear inside quotes
+func mermaidQuote(text string) string {
+	return "\"" + strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(text) + "\""
+}
@@ -1,32 +1,72 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
-	"os"
-	"sort"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// Error returned when the root path cannot be listed
+type InvalidRootError struct {
+	Path    string
+	Summary TreeSummary
+	// Reason the root cannot be listed
+	Err error
+}
+
+func (e *InvalidRootError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.message())
+}
+
+func (e *InvalidRootError) Unwrap() error {
+	return e.Err
+}
+
+// Message printed after the root path, with the reason it cannot be listed
+func (e *InvalidRootError) message() string {
+	if e.Err == nil {
+		return "error opening dir"
+	}
+	return fmt.Sprintf("error opening dir: %s", errorReason(e.Err))
+}
+
+// Tree holding only the root, as a directory that could not be opened
+func (e *InvalidRootError) tree(opts Options) *Tree {
+	info := &listEntry{name: filepath.Base(e.Path), mode: fs.ModeDir}
+	root := NewTreeNode(nil, nil, 0, false, e.Path, info)
+	root.Err = errors.New("opening dir")
+	if e.Err != nil {
+		root.Err = &EntryError{Op: "opening dir", Err: e.Err}
+	}
+	tree := NewTree(root, opts, e.Summary)
+	return &tree
+}
+
 func IsValid(rootPath string) (fs.FileInfo, error) {
-	fileInfo, err := os.Stat(rootPath)
-	var dir, file int
-	invalid := false
+	return isValidFS(newDiskFS(rootPath), rootPath)
+}
 
-	if err != nil {
-		invalid = true
-	} else if !fileInfo.IsDir() {
-		invalid = true
+// Checks that the root of fsys is a directory that can be listed
+func isValidFS(fsys fs.FS, rootPath string) (fs.FileInfo, error) {
+	fileInfo, err := fs.Stat(fsys, ".")
+	var dir, file int
+	if err == nil && !fileInfo.IsDir() {
 		file = 1
-	} else if fileInfo.Mode().Perm()&0400 == 0 {
-		invalid = true
+		err = syscall.ENOTDIR
+	} else if disk, ok := fsys.(diskFS); ok && err == nil {
 		dir = 1
+		err = canList(disk.root)
 	}
 
-	if invalid {
-		fmt.Printf("%s%s[error opening dir]\n", rootPath, strings.Repeat(" ", 4))
-		fmt.Printf("\n%v directories, %v files\n", dir, file)
-		return nil, fs.ErrExist
+	if err != nil {
+		summary := NewTreeSummary(dir, file)
+		// The root is the entry that could not be read
+		summary.Errors = 1
+		return nil, &InvalidRootError{Path: rootPath, Summary: summary, Err: err}
 	}
 	return fileInfo, nil
 }
@@ -52,42 +92,92 @@ func justDirs(files []fs.DirEntry) []fs.DirEntry {
 	return dirs
 }
 
-func sortByModifiedTime(files []fs.DirEntry) {
-	sort.Slice(files, func(i, j int) bool {
-		a := getFileInfo(files[i])
-		b := getFileInfo(files[j])
-		if a.ModTime().Before(b.ModTime()) {
-			return false
-		}
-		return true
-	})
+// Info of the entry. When it cannot be read, e.g. because the entry was
+// removed since its directory was listed, the little known from the
+// directory entry itself is returned along with the error.
+func getFileInfo(file fs.DirEntry) (fs.FileInfo, error) {
+	fileInfo, err := file.Info()
+	if err != nil || fileInfo == nil {
+		return entryInfo{file}, err
+	}
+	return fileInfo, nil
 }
 
-func sortByName(files []fs.DirEntry) {
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
-	})
+// File info made of a directory entry, with its type but no permissions
+type entryInfo struct {
+	fs.DirEntry
 }
 
-func getFileInfo(file fs.DirEntry) fs.FileInfo {
-	fileInfo, err := file.Info()
-	if err != nil {
-		fmt.Println(err)
+func (info entryInfo) Size() int64        { return 0 }
+func (info entryInfo) Mode() fs.FileMode  { return info.Type() }
+func (info entryInfo) ModTime() time.Time { return time.Time{} }
+func (info entryInfo) Sys() interface{}   { return nil }
+
+// Error of an entry that could not be read, recorded on its node
+type EntryError struct {
+	// What failed, e.g. "opening dir"
+	Op  string
+	Err error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, errorReason(e.Err))
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// Reason of an error without the path it is about, e.g. "permission denied"
+func errorReason(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
 	}
-	return fileInfo
+	return err.Error()
 }
 
-func hasReadPermission(file fs.DirEntry) bool {
-	fileInfo := getFileInfo(file)
-	if fileInfo.Mode().Perm()&0400 != 0 {
-		return true
+// Formats a size in bytes for the text output. Human readable sizes are
+// scaled to powers of 1024, or of 1000 with SI units.
+func formatSize(size int64, opts Options) string {
+	if !opts.Human && !opts.SI {
+		return fmt.Sprintf("%11d", size)
+	}
+	base := 1024.0
+	if opts.SI {
+		base = 1000.0
+	}
+	if float64(size) < base {
+		return fmt.Sprintf("%4d", size)
+	}
+	value := float64(size)
+	unit := 0
+	for value >= base && unit < len(sizeUnits)-1 {
+		value /= base
+		unit++
+	}
+	if value < 10 {
+		return fmt.Sprintf("%3.1f%c", value, sizeUnits[unit])
+	}
+	return fmt.Sprintf("%3.0f%c", value, sizeUnits[unit])
+}
+
+// Units of human readable sizes
+const sizeUnits = " KMGTPE"
+
+// Formats the total size for the summary line
+func formatTotalSize(size int64, opts Options) string {
+	if opts.Human || opts.SI {
+		return strings.TrimSpace(formatSize(size, opts))
 	}
-	return false
+	return fmt.Sprintf("%v bytes", size)
 }
 
 func getFileType(f fs.FileInfo) string {
 	filetype := "directory"
-	if !f.IsDir() {
+	if f.Mode()&fs.ModeSymlink != 0 {
+		filetype = "link"
+	} else if !f.IsDir() {
 		filetype = "file"
 	}
 	return filetype
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Title of the HTML page when none is given
+const defaultHTMLTitle = "Directory Tree"
+
+// Prints the directory tree as a standalone HTML page
+func (t *Tree) printHtmlTree(out *bytes.Buffer) {
+	title := t.Options.HTMLTitle
+	if title == "" {
+		title = defaultHTMLTitle
+	}
+	fmt.Fprintf(out, "<!DOCTYPE html>\n")
+	fmt.Fprintf(out, "<html>\n<head>\n")
+	fmt.Fprintf(out, "<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(out, "<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(out, "<style>\n")
+	fmt.Fprintf(out, "  body { font-family: sans-serif; }\n")
+	fmt.Fprintf(out, "  .tree { font-family: monospace; line-height: 1.2; }\n")
+	fmt.Fprintf(out, "  .tree a { text-decoration: none; }\n")
+	fmt.Fprintf(out, "  .tree a:hover { text-decoration: underline; }\n")
+	fmt.Fprintf(out, "</style>\n")
+	fmt.Fprintf(out, "</head>\n<body>\n")
+	fmt.Fprintf(out, "<h1>%s</h1>\n", html.EscapeString(title))
+	fmt.Fprintf(out, "<pre class=\"tree\">\n")
+	t.Root.drawhtml("", t.Root.Path, t.Options, out)
+	fmt.Fprintf(out, "</pre>\n")
+	fmt.Fprintf(out, "<hr>\n")
+	fmt.Fprintf(out, "<p class=\"report\">%s</p>\n", html.EscapeString(t.summaryLine()))
+	fmt.Fprintf(out, "</body>\n</html>\n")
+}
+
+// Prints the tree lines with every entry linked relative to the base URL
+func (node *TreeNode) drawhtml(indent string, root string, opts Options, out io.Writer) {
+	prefix := node.addSuffix(indent)
+	if opts.NoIndent {
+		prefix = ""
+	}
+	name := fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(node.href(root, opts.HTMLBase)), html.EscapeString(node.displayName(opts)))
+	line := node.decorate(name, html.EscapeString(node.Target), opts)
+	fmt.Fprintf(out, "%s%s%s\n", prefix, line, html.EscapeString(node.message()))
+
+	subIndent := node.addIndentation(indent)
+	for _, child := range node.Children {
+		child.drawhtml(subIndent, root, opts, out)
+	}
+}
+
+// Link to the entry relative to the base URL, directories end with "/"
+func (node *TreeNode) href(root string, base string) string {
+	segments := []string{}
+	if rel, err := filepath.Rel(root, node.Path); err == nil && rel != "." {
+		for _, segment := range strings.Split(filepath.ToSlash(rel), "/") {
+			segments = append(segments, url.PathEscape(segment))
+		}
+	}
+	link := strings.Join(segments, "/")
+	if base != "" {
+		link = strings.TrimSuffix(base, "/") + "/" + link
+	} else if link == "" {
+		link = "."
+	}
+	if node.resolvedInfo().IsDir() && !strings.HasSuffix(link, "/") {
+		link += "/"
+	}
+	return link
+}
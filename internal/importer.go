@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error returned when a saved tree is not valid go-tree output, naming
+// the offending entry by its path from the root
+type ImportError struct {
+	Path   string
+	Reason string
+}
+
+func (e *ImportError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("invalid tree: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid tree entry %q: %s", e.Path, e.Reason)
+}
+
+// File info of an imported entry, only the name, mode and size are known
+type importedInfo struct {
+	name string
+	mode fs.FileMode
+	size int64
+}
+
+func (info importedInfo) Name() string       { return info.name }
+func (info importedInfo) Size() int64        { return info.size }
+func (info importedInfo) Mode() fs.FileMode  { return info.mode }
+func (info importedInfo) ModTime() time.Time { return time.Time{} }
+func (info importedInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info importedInfo) Sys() interface{}   { return nil }
+
+// Entry of a saved tree, as decoded from either format
+type importedEntry struct {
+	Type      string
+	Name      string
+	Target    string
+	Broken    bool
+	Recursive bool
+	Mode      string
+	Size      *int64
+	Error     string
+	Contents  []importedEntry
+}
+
+// Reads a tree saved in JSON format, see printJsonTree
+func ReadJSON(r io.Reader, opts Options) (*Tree, error) {
+	var doc []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, &ImportError{Reason: err.Error()}
+	}
+	if len(doc) != 2 {
+		return nil, &ImportError{Reason: fmt.Sprintf("expected the root entry and the report, found %d elements", len(doc))}
+	}
+	var root jsonEntry
+	if err := json.Unmarshal(doc[0], &root); err != nil {
+		return nil, &ImportError{Reason: fmt.Sprintf("root entry: %v", err)}
+	}
+	var report jsonReport
+	if err := json.Unmarshal(doc[1], &report); err != nil {
+		return nil, &ImportError{Reason: fmt.Sprintf("report: %v", err)}
+	}
+	if report.Type != "report" {
+		return nil, &ImportError{Reason: fmt.Sprintf("expected a report after the root entry, found type %q", report.Type)}
+	}
+	summary := NewTreeSummary(report.Directories, 0)
+	if report.Files != nil {
+		summary.Files = *report.Files
+	}
+	if report.Size != nil {
+		summary.Size = *report.Size
+	}
+	summary.Errors = report.Errors
+	summary.Truncated = report.Truncated
+	return importTree(root.imported(), opts, summary)
+}
+
+func (entry jsonEntry) imported() importedEntry {
+	imported := importedEntry{
+		Type:      entry.Type,
+		Name:      entry.Name,
+		Broken:    entry.Broken,
+		Recursive: entry.Recursive,
+		Mode:      entry.Mode,
+		Size:      entry.Size,
+		Error:     entry.Error,
+	}
+	if entry.Target != nil {
+		imported.Target = *entry.Target
+	}
+	for _, child := range entry.Contents {
+		imported.Contents = append(imported.Contents, child.imported())
+	}
+	return imported
+}
+
+// Reads a tree saved in XML format, see printXmlTree
+func ReadXML(r io.Reader, opts Options) (*Tree, error) {
+	var doc xmlTree
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, &ImportError{Reason: err.Error()}
+	}
+	summary := NewTreeSummary(doc.Report.Directories, 0)
+	if doc.Report.Files != nil {
+		summary.Files = *doc.Report.Files
+	}
+	if doc.Report.Size != nil {
+		summary.Size = *doc.Report.Size
+	}
+	summary.Errors = doc.Report.Errors
+	summary.Truncated = doc.Report.Truncated
+	return importTree(doc.Root.imported(), opts, summary)
+}
+
+func (entry xmlEntry) imported() importedEntry {
+	imported := importedEntry{
+		Type:      entry.XMLName.Local,
+		Name:      entry.Name,
+		Target:    entry.Target,
+		Broken:    entry.Broken,
+		Recursive: entry.Recursive,
+		Mode:      entry.Mode,
+		Size:      entry.Size,
+		Error:     entry.Error,
+	}
+	for _, child := range entry.Contents {
+		imported.Contents = append(imported.Contents, child.imported())
+	}
+	return imported
+}
+
+// Rebuilds the tree of the root entry
+func importTree(entry importedEntry, opts Options, summary TreeSummary) (*Tree, error) {
+	if entry.Type != "directory" {
+		return nil, &ImportError{Path: entry.Name, Reason: fmt.Sprintf("root must be a directory, found %q", entry.Type)}
+	}
+	root, err := entry.node(nil, 0, false, entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	tree := NewTree(root, opts, summary)
+	return &tree, nil
+}
+
+// Converts the entry at path and its contents to a tree node
+func (entry importedEntry) node(parent *TreeNode, depth int, isLast bool, path string) (TreeNode, error) {
+	if entry.Name == "" {
+		return TreeNode{}, &ImportError{Path: path, Reason: "missing name"}
+	}
+	info := importedInfo{name: filepath.Base(entry.Name)}
+	switch entry.Type {
+	case "directory":
+		info.mode = fs.ModeDir | 0755
+	case "file":
+		info.mode = 0644
+	case "link":
+		info.mode = fs.ModeSymlink | 0777
+	default:
+		return TreeNode{}, &ImportError{Path: path, Reason: fmt.Sprintf("unknown type %q", entry.Type)}
+	}
+	if entry.Mode != "" {
+		perm, err := strconv.ParseUint(entry.Mode, 8, 32)
+		if err != nil || fs.FileMode(perm)&^fs.ModePerm != 0 {
+			return TreeNode{}, &ImportError{Path: path, Reason: fmt.Sprintf("invalid mode %q", entry.Mode)}
+		}
+		info.mode = info.mode.Type() | fs.FileMode(perm)
+	}
+	if entry.Size != nil {
+		info.size = *entry.Size
+	}
+	if entry.Type == "file" && len(entry.Contents) > 0 {
+		return TreeNode{}, &ImportError{Path: path, Reason: "a file cannot have contents"}
+	}
+
+	node := NewTreeNode(parent, nil, depth, isLast, path, info)
+	if entry.Error != "" {
+		node.Err = errors.New(entry.Error)
+	}
+	if entry.Type == "link" {
+		node.Target = entry.Target
+		node.Recursive = entry.Recursive
+		if !entry.Broken {
+			// Links with contents, or not followed, point to a directory
+			target := importedInfo{name: info.name, mode: 0644}
+			if len(entry.Contents) > 0 || entry.Recursive {
+				target.mode = fs.ModeDir | 0755
+			}
+			node.TargetInfo = target
+		}
+	}
+	for i, child := range entry.Contents {
+		childPath, err := importedPath(path, child.Name)
+		if err != nil {
+			return TreeNode{}, &ImportError{Path: fmt.Sprintf("%s/#%d", filepath.ToSlash(path), i+1), Reason: err.Error()}
+		}
+		childNode, err := child.node(&node, depth+1, i+1 == len(entry.Contents), childPath)
+		if err != nil {
+			return TreeNode{}, err
+		}
+		node.Children = append(node.Children, childNode)
+	}
+	return node, nil
+}
+
+// Path of a child entry, whose name is either a base name or, with full
+// paths, the path of its parent followed by the base name
+func importedPath(parent string, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("missing name")
+	}
+	if !strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return filepath.Join(parent, name), nil
+	}
+	if filepath.Dir(name) == filepath.Clean(parent) {
+		return name, nil
+	}
+	return "", fmt.Errorf("name %q is not a base name or a path below %q", name, parent)
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// An entry of the JSON output, also used by the YAML and TOML outputs
+type jsonEntry struct {
+	Type      string      `json:"type" yaml:"type" toml:"type"`
+	Name      string      `json:"name" yaml:"name" toml:"name"`
+	Target    *string     `json:"target,omitempty" yaml:"target,omitempty" toml:"target,omitempty"`
+	Broken    bool        `json:"broken,omitempty" yaml:"broken,omitempty" toml:"broken,omitempty"`
+	Recursive bool        `json:"recursive,omitempty" yaml:"recursive,omitempty" toml:"recursive,omitempty"`
+	Mode      string      `json:"mode,omitempty" yaml:"mode,omitempty" toml:"mode,omitempty"`
+	Prot      string      `json:"prot,omitempty" yaml:"prot,omitempty" toml:"prot,omitempty"`
+	Size      *int64      `json:"size,omitempty" yaml:"size,omitempty" toml:"size,omitempty"`
+	Error     string      `json:"error,omitempty" yaml:"error,omitempty" toml:"error,omitempty"`
+	Contents  []jsonEntry `json:"contents,omitempty" yaml:"contents,omitempty" toml:"contents,omitempty"`
+}
+
+// The summary report closing the JSON output
+type jsonReport struct {
+	Type        string `json:"type" yaml:"type" toml:"type"`
+	Directories int    `json:"directories" yaml:"directories" toml:"directories"`
+	Files       *int   `json:"files,omitempty" yaml:"files,omitempty" toml:"files,omitempty"`
+	Size        *int64 `json:"size,omitempty" yaml:"size,omitempty" toml:"size,omitempty"`
+	Errors      int    `json:"errors,omitempty" yaml:"errors,omitempty" toml:"errors,omitempty"`
+	Truncated   string `json:"truncated,omitempty" yaml:"truncated,omitempty" toml:"truncated,omitempty"`
+}
+
+// Prints the directory tree in JSON format: an array holding the root
+// entry followed by the summary report
+func (t *Tree) printJsonTree(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	// print without indentation
+	if !t.Options.NoIndent {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode([]interface{}{t.Root.jsonEntry(t.Options), t.jsonReport()})
+}
+
+// Converts the node and its children to JSON entries
+func (node *TreeNode) jsonEntry(opts Options) jsonEntry {
+	entry := jsonEntry{
+		Type: getFileType(node.Info),
+		Name: node.Info.Name(),
+	}
+	if opts.FullPath || node.Root == nil {
+		entry.Name = node.Path
+	}
+	if node.isLink() {
+		target := node.Target
+		entry.Target = &target
+		entry.Broken = node.isBrokenLink()
+		entry.Recursive = node.Recursive
+	}
+	if opts.Permission {
+		entry.Mode = fmt.Sprintf("%04o", node.Info.Mode().Perm())
+		entry.Prot = node.Info.Mode().String()
+	}
+	if opts.showSize() {
+		size := node.Size
+		entry.Size = &size
+	}
+	entry.Error = node.errorText()
+	for _, child := range node.Children {
+		entry.Contents = append(entry.Contents, child.jsonEntry(opts))
+	}
+	return entry
+}
+
+func (t *Tree) jsonReport() jsonReport {
+	report := jsonReport{
+		Type:        "report",
+		Directories: t.Summary.Directories,
+		Errors:      t.Summary.Errors,
+		Truncated:   t.Summary.Truncated,
+	}
+	if !t.Options.DirsOnly {
+		files := t.Summary.Files
+		report.Files = &files
+	}
+	if t.Options.showSize() {
+		size := t.Summary.Size
+		report.Size = &size
+	}
+	return report
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Directory entry of a symbolic link reporting the type of its target,
+// so that links to directories are listed and counted as directories
+type linkEntry struct {
+	fs.DirEntry
+	target fs.FileInfo
+}
+
+func (entry linkEntry) IsDir() bool {
+	return entry.target.IsDir()
+}
+
+// Resolves the symbolic links among the entries of dirPath, leaving
+// broken links untouched
+func (b *builder) followLinks(dirPath string, files []fs.DirEntry) []fs.DirEntry {
+	for i, file := range files {
+		if file.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+		target, err := fs.Stat(b.fsys, b.fsPath(filepath.Join(dirPath, file.Name())))
+		if err != nil {
+			continue
+		}
+		files[i] = linkEntry{DirEntry: file, target: target}
+	}
+	return files
+}
+
+// Reports if the node is a symbolic link
+func (node *TreeNode) isLink() bool {
+	return node.Info.Mode()&fs.ModeSymlink != 0
+}
+
+// Reports if the node is a symbolic link to a missing target
+func (node *TreeNode) isBrokenLink() bool {
+	return node.isLink() && node.TargetInfo == nil
+}
+
+// Info of the node with symbolic links resolved
+func (node *TreeNode) resolvedInfo() fs.FileInfo {
+	if node.isLink() && node.TargetInfo != nil {
+		return node.TargetInfo
+	}
+	return node.Info
+}
+
+// Reports if info refers to the same directory as one of the ancestors
+func isAncestor(ancestors []fs.FileInfo, info fs.FileInfo) bool {
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			return true
+		}
+	}
+	return false
+}
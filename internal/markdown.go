@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Markdown styles accepted by Options.MarkdownStyle
+const (
+	// The text tree in a fenced code block
+	MarkdownCode = "code"
+	// A nested bullet list linking every entry
+	MarkdownList = "list"
+)
+
+// Prints the directory tree as Markdown for READMEs and docs
+func (t *Tree) printMarkdownTree(out *bytes.Buffer) error {
+	switch t.Options.MarkdownStyle {
+	case MarkdownCode, "":
+		t.printMarkdownCode(out)
+	case MarkdownList:
+		t.printMarkdownList(out)
+	default:
+		return fmt.Errorf("unknown markdown style %q", t.Options.MarkdownStyle)
+	}
+	return nil
+}
+
+// Prints the text tree in a fenced code block, the fence being longer
+// than any run of backticks in the tree
+func (t *Tree) printMarkdownCode(out *bytes.Buffer) {
+	var text bytes.Buffer
+	plain := *t
+	plain.Options.Color = false
+	plain.printTree(&text)
+
+	fence := "```"
+	for strings.Contains(text.String(), fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(out, "%stext\n%s%s\n", fence, text.String(), fence)
+}
+
+// Prints the entries below the root as a nested bullet list linking to
+// their paths relative to the root, followed by the summary line
+func (t *Tree) printMarkdownList(out *bytes.Buffer) {
+	for _, child := range t.Root.Children {
+		child.drawmarkdown("", t.Root.Path, t.Options, out)
+	}
+	fmt.Fprintf(out, "\n%s\n", t.summaryLine())
+}
+
+func (node *TreeNode) drawmarkdown(indent string, root string, opts Options, out io.Writer) {
+	name := escapeMarkdown(node.displayName(opts))
+	if node.resolvedInfo().IsDir() {
+		name += "/"
+	}
+	link := strings.NewReplacer("(", "%28", ")", "%29").Replace(node.href(root, ""))
+	line := fmt.Sprintf("%s- [%s](%s)", indent, name, link)
+	if description, ok := opts.Descriptions[node.descriptionKey(root)]; ok {
+		line = fmt.Sprintf("%s - %s", line, description)
+	}
+	fmt.Fprintln(out, line)
+
+	for _, child := range node.Children {
+		child.drawmarkdown(indent+strings.Repeat(" ", 2), root, opts, out)
+	}
+}
+
+// Slash separated path relative to the root, as used in description files
+func (node *TreeNode) descriptionKey(root string) string {
+	rel, err := filepath.Rel(root, node.Path)
+	if err != nil {
+		return filepath.ToSlash(node.Path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Escapes the characters with a meaning in Markdown link text
+func escapeMarkdown(text string) string {
+	var escaped strings.Builder
+	for _, c := range text {
+		if strings.ContainsRune("\\`*_[]<>#|!", c) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
+
+// Reads per entry descriptions for the Markdown list. Each line holds a
+// path relative to the root and its description separated by ": ". Blank
+// lines and lines starting with "#" are skipped.
+func ReadDescriptions(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	descriptions := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, description, ok := strings.Cut(text, ": ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"path: description\"", path, line)
+		}
+		entry = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(entry), "./"), "/")
+		descriptions[entry] = strings.TrimSpace(description)
+	}
+	return descriptions, scanner.Err()
+}
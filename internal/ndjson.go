@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A line of the NDJSON output describing a single entry
+type ndjsonEntry struct {
+	Path   string    `json:"path"`
+	Depth  int       `json:"depth"`
+	Type   string    `json:"type"`
+	Size   int64     `json:"size"`
+	Mode   string    `json:"mode"`
+	Mtime  time.Time `json:"mtime"`
+	Parent string    `json:"parent,omitempty"`
+	Target *string   `json:"target,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// A line of the NDJSON output reporting an entry that could not be read
+// after it was written, such as a directory that fails to open. Other
+// entries carry their error on their own line.
+type ndjsonError struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+func newNDJSONEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
+
+// Streams the entries of the tree at rootPath to w as newline delimited
+// JSON while the tree is being built, without keeping them in memory.
+// The last line holds the summary report. With --du the tree is built
+// before it is written.
+func Stream(w io.Writer, rootPath string, opts Options) error {
+	return StreamContext(context.Background(), w, rootPath, opts)
+}
+
+// Streams the entries of the tree at rootPath until ctx is done, ending
+// with a report flagged as truncated
+func StreamContext(ctx context.Context, w io.Writer, rootPath string, opts Options) error {
+	_, err := stream(ctx, w, rootPath, opts)
+	return err
+}
+
+// Streams the tree, returning its summary
+func stream(ctx context.Context, w io.Writer, rootPath string, opts Options) (TreeSummary, error) {
+	// The size of a directory with --du is only known after its subtree,
+	// so the tree is built before it is written
+	if opts.DiskUsage {
+		tree, err := BuildContext(ctx, rootPath, opts)
+		if err != nil {
+			return TreeSummary{}, err
+		}
+		return tree.Summary, tree.printNDJSONTree(w)
+	}
+	info, err := IsValid(rootPath)
+	if err != nil {
+		return TreeSummary{}, err
+	}
+
+	encoder := newNDJSONEncoder(w)
+	root := NewTreeNode(nil, nil, 0, false, rootPath, info)
+	summary := NewTreeSummary(1, 0)
+	b, err := newBuilder(ctx, newDiskFS(rootPath), rootPath, opts, &summary)
+	if err != nil {
+		return summary, err
+	}
+	// Entries are written in order as they are discovered, so the tree
+	// is built serially
+	b.workers = nil
+	b.visit = func(node *TreeNode) error {
+		return encoder.Encode(node.ndjsonEntry())
+	}
+	// Directories fail to open after their entry is written
+	b.failed = func(node *TreeNode) error {
+		return encoder.Encode(ndjsonError{Path: node.Path, Type: "error", Error: node.errorText()})
+	}
+	if err := b.visit(&root); err != nil {
+		return summary, err
+	}
+	if err := root.build(b); err != nil {
+		return summary, err
+	}
+	tree := NewTree(root, opts, summary)
+	return summary, encoder.Encode(tree.jsonReport())
+}
+
+// Prints an already built tree in NDJSON format
+func (t *Tree) printNDJSONTree(out io.Writer) error {
+	encoder := newNDJSONEncoder(out)
+	if err := t.Root.encodeNDJSON(encoder); err != nil {
+		return err
+	}
+	return encoder.Encode(t.jsonReport())
+}
+
+// Writes the node followed by its children
+func (node *TreeNode) encodeNDJSON(encoder *json.Encoder) error {
+	if err := encoder.Encode(node.ndjsonEntry()); err != nil {
+		return err
+	}
+	for i := range node.Children {
+		if err := node.Children[i].encodeNDJSON(encoder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (node *TreeNode) ndjsonEntry() ndjsonEntry {
+	entry := ndjsonEntry{
+		Path:  node.Path,
+		Depth: node.Depth,
+		Type:  getFileType(node.Info),
+		Size:  node.Size,
+		Mode:  fmt.Sprintf("%04o", node.Info.Mode().Perm()),
+		Mtime: node.Info.ModTime(),
+	}
+	if node.Root != nil {
+		entry.Parent = node.Root.Path
+	}
+	if node.isLink() {
+		target := node.Target
+		entry.Target = &target
+	}
+	entry.Error = node.errorText()
+	return entry
+}
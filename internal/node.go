@@ -1,12 +1,13 @@
 package internal
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"go-tree/constant"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 type TreeNode struct {
@@ -16,10 +17,20 @@ type TreeNode struct {
 	IsLast   bool
 	Path     string
 	Info     os.FileInfo
+	// Size in bytes, including everything beneath a directory with --du
+	Size int64
+	// Target of a symbolic link and its info, nil if the link is broken
+	Target     string
+	TargetInfo os.FileInfo
+	// Link to an ancestor directory that was not followed
+	Recursive bool
+	// Error reading the entry or listing the directory, the scan goes on
+	// without its contents
+	Err error
 }
 
 func NewTreeNode(root *TreeNode, children []TreeNode, depth int, isLast bool, path string, info os.FileInfo) TreeNode {
-	return TreeNode{
+	node := TreeNode{
 		Root:     root,
 		Children: children,
 		Depth:    depth,
@@ -27,96 +38,271 @@ func NewTreeNode(root *TreeNode, children []TreeNode, depth int, isLast bool, pa
 		Path:     path,
 		Info:     info,
 	}
+	if info != nil {
+		node.Size = info.Size()
+	}
+	return node
 }
 
-func (node *TreeNode) BuildTree(flags map[string]interface{}, summary *TreeSummary) error {
-	dir, err := os.Open(node.Path)
+func (node *TreeNode) BuildTree(opts Options, summary *TreeSummary) error {
+	b, err := newBuilder(context.Background(), newDiskFS(node.Path), node.Path, opts, summary)
 	if err != nil {
 		return err
 	}
-	defer dir.Close()
+	return node.build(b)
+}
 
-	files, err := dir.ReadDir(-1)
+// Builds the tree below the root node
+func (node *TreeNode) build(b *builder) error {
+	scope, err := b.rootScope(node.Info)
 	if err != nil {
 		return err
 	}
+	if err := node.buildTree(b, scope); err != nil {
+		return err
+	}
+	// Grand total includes the root directory itself
+	if b.opts.DiskUsage {
+		b.summary.Size = node.Size
+	}
+	b.summary.Truncated = b.budget.truncated()
+	return nil
+}
+
+// Reads the directory and recursively builds its children
+func (node *TreeNode) buildTree(b *builder, scope dirScope) error {
+	opts := b.opts
+	// A stopped scan leaves the remaining directories empty
+	if b.budget.stopped() {
+		return nil
+	}
+	files, err := b.readDir(node.Path)
+	if err != nil {
+		return b.fail(node, "opening dir", err)
+	}
+	if opts.FollowLinks {
+		files = b.followLinks(node.Path, files)
+	}
+
+	// Gitignore files of this directory apply to its whole subtree
+	scope, err = b.enterDir(node.Path, scope)
+	if err != nil {
+		if err := b.fail(node, "reading gitignore", err); err != nil {
+			return err
+		}
+	}
+	files = b.filterGitignored(node.Path, files, scope)
 
-	// Skip hidden files and directories
-	files = exceptHiddens(files)
+	// Skip hidden files and directories unless all entries are listed
+	if !opts.All {
+		files = exceptHiddens(files)
+	}
+	// Apply include and exclude patterns
+	files = b.filterPatterns(node.Path, files, scope)
+	// Sort files by name, or the selected sort order
+	sortEntries(files, opts)
+	// Only list the entries left in the budget. Files are not listed with
+	// -d, but they are still counted and sized.
+	if opts.DirsOnly {
+		files = b.budget.takeDirs(files, opts.MaxEntries)
+	} else {
+		files = b.budget.take(files, opts.MaxEntries)
+	}
 	// list of directories
 	dirs := justDirs(files)
 	// Add to tree summary
-	summary.Directories += len(dirs)
-	summary.Files += len(files) - len(dirs)
+	b.summary.Directories += len(dirs)
+	b.summary.Files += len(files) - len(dirs)
+	// Size of the files in this directory, subdirectories are added below
+	var contentSize int64
+	if opts.showSize() {
+		for _, file := range files {
+			info, _ := getFileInfo(file)
+			size := info.Size()
+			b.summary.Size += size
+			if !file.IsDir() {
+				contentSize += size
+			}
+		}
+	}
 	// only list directories
-	if justDir := *(flags[constant.Dir].(*bool)); justDir {
+	if opts.DirsOnly {
 		files = dirs
 	}
-	// Sort files by time modified
-	if sortByTime := *(flags[constant.Time].(*bool)); sortByTime {
-		sortByModifiedTime(files)
-	} else { // Sort files by name
-		sortByName(files)
-	}
 
+	// Subdirectories are built by the workers of the pool when available
+	children := make([]TreeNode, len(files))
+	jobs := make([]job, len(files))
+	var wg sync.WaitGroup
 	for i, file := range files {
 		isLast := false
 		if i+1 == len(files) {
 			isLast = true
 		}
 		path := filepath.Join(node.Path, file.Name())
-		info := getFileInfo(file)
-		childNode := NewTreeNode(node, nil, node.Depth+1, isLast, path, info)
-
-		// Build tree upto max level
-		maxDepth := *(flags[constant.Level].(*int))
-		if childNode.Info.IsDir() && (maxDepth == 0 || childNode.Depth < maxDepth) {
-			// Build child node if directory has read permission
-			if childNode.Info.Mode().Perm()&0400 != 0 {
-				if err := childNode.BuildTree(flags, summary); err != nil {
-					return err
-				}
+		info, err := getFileInfo(file)
+		children[i] = NewTreeNode(node, nil, node.Depth+1, isLast, path, info)
+		childNode := &children[i]
+		if err != nil {
+			b.record(childNode, "reading entry", err)
+		}
+		if childNode.isLink() {
+			childNode.Target, childNode.TargetInfo = b.readLink(path)
+		}
+
+		// Do not follow links back to an ancestor directory
+		isDir := file.IsDir()
+		if isDir && childNode.isLink() && isAncestor(scope.ancestors, childNode.TargetInfo) {
+			childNode.Recursive = true
+		}
+		// Only directories read without error are listed, and each entry
+		// records a single error
+		listable := isDir && !childNode.Recursive && childNode.Err == nil
+		if listable {
+			if err := b.canList(childNode.Path); err != nil {
+				b.record(childNode, "opening dir", err)
+				listable = false
+			}
+		}
+		// The visited entry carries its error
+		if b.visit != nil {
+			if err := b.visit(childNode); err != nil {
+				return err
+			}
+		}
+
+		// Build child node if the directory can be listed
+		if listable {
+			childScope := b.childScope(childNode, scope)
+			// Build tree upto max level
+			maxDepth := opts.Level
+			if maxDepth == 0 || childNode.Depth < maxDepth {
+				b.run(&wg, &jobs[i], func(b *builder) error {
+					return childNode.buildTree(b, childScope)
+				})
+			} else if opts.DiskUsage {
+				b.run(&wg, &jobs[i], func(b *builder) error {
+					return childNode.measureTree(b, childScope)
+				})
 			}
 		}
-		node.Children = append(node.Children, childNode)
+	}
+	wg.Wait()
+	for i, file := range files {
+		if err := b.collect(&jobs[i]); err != nil {
+			return err
+		}
+		if file.IsDir() {
+			contentSize += children[i].Size
+		}
+	}
+	// Visited nodes have already been written out
+	if b.visit == nil && len(children) > 0 {
+		node.Children = children
+	}
+	// Directory size is the accumulation of everything beneath it
+	if opts.DiskUsage {
+		node.Size = node.Info.Size() + contentSize
 	}
 	return nil
 }
 
-func (node *TreeNode) draw(indent string, flags map[string]interface{}, out *bytes.Buffer) {
-	node.print(node.addSuffix(indent), flags, out)
+// Accumulates the size of a directory past the max level by scanning its
+// subtree without keeping its children or counting them in the summary.
+// The unlisted entries are not limited by the max entries, but the scan
+// still stops when the budget is done.
+func (node *TreeNode) measureTree(b *builder, scope dirScope) error {
+	measure := *b
+	measure.summary = &TreeSummary{}
+	measure.visit = nil
+	measure.failed = nil
+	measure.opts.Level = 0
+	measure.opts.MaxEntries = 0
+	err := node.buildTree(&measure, scope)
+	node.Children = nil
+	return err
+}
+
+func (node *TreeNode) draw(indent string, opts Options, colors *lsColors, out io.Writer) {
+	node.print(node.addSuffix(indent), opts, colors, out)
 
 	subIndent := node.addIndentation(indent)
 	for _, child := range node.Children {
 		if child.Children != nil {
-			child.draw(subIndent, flags, out)
+			child.draw(subIndent, opts, colors, out)
 		} else {
-			child.print(child.addSuffix(subIndent), flags, out)
+			child.print(child.addSuffix(subIndent), opts, colors, out)
 		}
 	}
 }
 
-// Print line
-func (node *TreeNode) print(indent string, flags map[string]interface{}, out *bytes.Buffer) {
+// Print line, colorizing the name unless colors is nil
+func (node *TreeNode) print(indent string, opts Options, colors *lsColors, out io.Writer) {
 	// print without indentation
-	if noIndent := *(flags[constant.Indent].(*bool)); noIndent {
+	if opts.NoIndent {
 		indent = ""
 	}
+	name := node.displayName(opts)
+	if colors != nil {
+		name = colors.paint(name, node)
+	}
+	fmt.Fprintf(out, "%s%s%s\n", indent, node.decorate(name, node.Target, opts), node.message())
+}
+
+// Name of the entry, or its path for the root and with full paths
+func (node *TreeNode) displayName(opts Options) string {
 	name := filepath.Base(node.Path)
 	// print full path
-	if hasPath := *(flags[constant.Path].(*bool)); hasPath || node.Root == nil {
+	if opts.FullPath || node.Root == nil {
 		name = node.Path
 	}
-	// print file permissions
-	if hasMode := *(flags[constant.Permission].(*bool)); hasMode && node.Root != nil {
-		name = fmt.Sprintf("[%v] %v", node.Info.Mode(), name)
+	return name
+}
+
+// Surrounds the formatted name with the permission and size attributes
+// and the link target
+func (node *TreeNode) decorate(name string, target string, opts Options) string {
+	// print file permissions and size
+	if node.Root != nil {
+		attrs := []string{}
+		if opts.Permission {
+			attrs = append(attrs, node.Info.Mode().String())
+		}
+		if opts.showSize() {
+			attrs = append(attrs, formatSize(node.Size, opts))
+		}
+		if len(attrs) > 0 {
+			name = fmt.Sprintf("[%v] %v", strings.Join(attrs, " "), name)
+		}
+	}
+	// print link target
+	if node.isLink() && node.Target != "" {
+		name = fmt.Sprintf("%s -> %s", name, target)
 	}
-	// print msg if no read permission on directory
+	return name
+}
+
+// Message printed after the name of entries that could not be listed
+func (node *TreeNode) message() string {
+	// print msg if the entry could not be read
 	msg := ""
-	if node.Info.Mode().Perm()&0400 == 0 {
-		msg = fmt.Sprintf("%s[error opening dir]", strings.Repeat(" ", 4))
+	if text := node.errorText(); text != "" {
+		msg = fmt.Sprintf("%s[error %s]", strings.Repeat(" ", 4), text)
+	} else if node.Recursive {
+		msg = fmt.Sprintf("%s[recursive, not followed]", strings.Repeat(" ", 4))
+	} else if node.isBrokenLink() {
+		msg = fmt.Sprintf("%s[broken link]", strings.Repeat(" ", 4))
+	}
+	return msg
+}
+
+// Description of the error of the node, such as "opening dir: permission
+// denied", empty if there is none
+func (node *TreeNode) errorText() string {
+	if node.Err != nil {
+		return node.Err.Error()
 	}
-	fmt.Fprintf(out, "%s%s%s\n", indent, name, msg)
+	return ""
 }
 
 // Indentation prefix
@@ -143,67 +329,3 @@ func (node *TreeNode) addSuffix(prefix string) string {
 	}
 	return line
 }
-
-// Prints the directory tree in JSON format
-func (node *TreeNode) drawjson(indent string, flags map[string]interface{}, out *bytes.Buffer) {
-	newline := fmt.Sprintf("\n")
-	// print without indentation
-	noIndent := *(flags[constant.Indent].(*bool))
-	if noIndent {
-		indent = ""
-		newline = ""
-	}
-	filetype := getFileType(node.Info)
-	name := node.Info.Name()
-	if hasPath := *(flags[constant.Path].(*bool)); hasPath || node.Root == nil {
-		name = node.Path
-	}
-	line := fmt.Sprintf("%s{\"type\":\"%s\",\"name\":\"%s\"", indent, filetype, name)
-	if hasMode := *(flags[constant.Permission].(*bool)); hasMode {
-		line = fmt.Sprintf("%s,\"mode\":\"%04o\",\"prot\":\"%v\"", line, node.Info.Mode().Perm(), node.Info.Mode())
-	}
-
-	if len(node.Children) > 0 {
-		line = fmt.Sprintf("%s,\"contents\":[", line)
-		fmt.Fprintf(out, "%s%s", line, newline)
-		for i, child := range node.Children {
-			if i > 0 {
-				fmt.Fprintf(out, ",%s", newline)
-			}
-			child.drawjson(indent+strings.Repeat(" ", 2), flags, out)
-		}
-		fmt.Fprintf(out, "%s%s]", newline, indent)
-	} else {
-		fmt.Fprintf(out, line)
-	}
-	fmt.Fprintf(out, "}")
-}
-
-// Prints the directory tree in XML format.
-func (node *TreeNode) drawxml(indent string, flags map[string]interface{}, out *bytes.Buffer) {
-	newline := fmt.Sprintf("\n")
-	noIndent := *(flags[constant.Indent].(*bool))
-	if noIndent {
-		indent = ""
-		newline = ""
-	}
-	filetype := getFileType(node.Info)
-	name := node.Info.Name()
-	if hasPath := *(flags[constant.Path].(*bool)); hasPath || node.Root == nil {
-		name = node.Path
-	}
-	line := fmt.Sprintf("%s<%s name=\"%s\"", indent, filetype, name)
-	if hasMode := *(flags[constant.Permission].(*bool)); hasMode {
-		line = fmt.Sprintf("%s mode=\"%04o\" prot=\"%v\"", line, node.Info.Mode().Perm(), node.Info.Mode())
-	}
-
-	if len(node.Children) > 0 {
-		fmt.Fprintf(out, "%s>\n", line)
-		for _, child := range node.Children {
-			child.drawxml(indent+strings.Repeat(" ", 2), flags, out)
-		}
-		fmt.Fprintf(out, "%s</%s>%s", indent, filetype, newline)
-	} else {
-		fmt.Fprintf(out, "%s></%s>%s", line, filetype, newline)
-	}
-}
@@ -0,0 +1,79 @@
+package internal
+
+// Options controls how a directory tree is built and rendered
+type Options struct {
+	// Read the root path as a zip or tar archive, which is also done for
+	// root files named like one
+	Archive bool
+	// Number of directories scanned concurrently, 0 or 1 scans serially as
+	// does a max number of entries
+	Jobs int
+	// Stop the scan after listing this many entries, 0 means no limit
+	MaxEntries int
+	// Show the full path prefix of each entry
+	FullPath bool
+	// List hidden entries whose names start with a dot
+	All bool
+	// Only list files matching this pattern, "|" separates alternatives
+	Pattern string
+	// Do not list entries matching this pattern
+	Exclude string
+	// Match patterns case-insensitively
+	IgnoreCase bool
+	// Also match directory names against Pattern
+	MatchDirs bool
+	// Skip entries ignored by .gitignore files and .git/info/exclude
+	GitIgnore bool
+	// Follow symbolic links to directories as if they were directories
+	FollowLinks bool
+	// Only list directories
+	DirsOnly bool
+	// Max level of tree depth, 0 means no limit
+	Level int
+	// Show permission modes
+	Permission bool
+	// Sort entries by modified time instead of name, same as Sort "mtime"
+	SortByTime bool
+	// Sort order, one of the Sort* constants, defaults to name
+	Sort string
+	// Reverse the sort order
+	Reverse bool
+	// List directories before files
+	DirsFirst bool
+	// List files before directories
+	FilesFirst bool
+	// Print without indentation lines
+	NoIndent bool
+	// Base URL the entries of the HTML output link to
+	HTMLBase string
+	// Title of the HTML page
+	HTMLTitle string
+	// Columns of the CSV and TSV outputs, one of the Column* constants
+	Columns []string
+	// End the CSV and TSV outputs with the summary line
+	CSVSummary bool
+	// Style of the Markdown output, one of the Markdown* constants
+	MarkdownStyle string
+	// Descriptions shown next to the entries of the Markdown list, keyed
+	// by their slash separated path relative to the root
+	Descriptions map[string]string
+	// Direction of the graph outputs: TB, BT, LR or RL
+	Rankdir string
+	// Max depth drawn in the graph outputs, 0 means no limit
+	GraphDepth int
+	// Colorize names in the text output using LS_COLORS
+	Color bool
+	// Show the size of each entry in bytes
+	Size bool
+	// Show sizes in human readable powers of 1024 (K, M, G, ...)
+	Human bool
+	// Show sizes in human readable powers of 1000
+	SI bool
+	// Show the size of directories as the accumulation of their contents
+	DiskUsage bool
+}
+
+// Reports if entry sizes are shown
+func (opts Options) showSize() bool {
+	return opts.Size || opts.Human || opts.SI || opts.DiskUsage
+}
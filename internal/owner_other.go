@@ -0,0 +1,10 @@
+//go:build !unix
+
+package internal
+
+import "io/fs"
+
+// File owners are not available on this platform
+func fileOwner(info fs.FileInfo, owners map[uint32]string) string {
+	return ""
+}
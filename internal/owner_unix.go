@@ -0,0 +1,29 @@
+//go:build unix
+
+package internal
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// Name of the user owning the file, or its uid if it cannot be looked up.
+// Looked up names are cached in owners.
+func fileOwner(info fs.FileInfo, owners map[uint32]string) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	if name, ok := owners[stat.Uid]; ok {
+		return name
+	}
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	owners[stat.Uid] = name
+	return name
+}
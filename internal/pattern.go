@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A set of "|" separated glob alternatives
+type pattern struct {
+	globs []glob
+}
+
+// A single glob compiled into a regular expression
+type glob struct {
+	re *regexp.Regexp
+	// Pattern contains a "/" and is matched against the relative path
+	// instead of the base name
+	hasSlash bool
+}
+
+func compilePattern(expr string, ignoreCase bool) (*pattern, error) {
+	p := &pattern{}
+	for _, alt := range strings.Split(expr, "|") {
+		if alt == "" {
+			continue
+		}
+		re, err := globToRegexp(alt, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		p.globs = append(p.globs, glob{re: re, hasSlash: strings.Contains(alt, "/")})
+	}
+	return p, nil
+}
+
+// Reports if the entry with the given slash separated relative path
+// matches any of the alternatives
+func (p *pattern) match(relPath string) bool {
+	name := path.Base(relPath)
+	for _, g := range p.globs {
+		subject := name
+		if g.hasSlash {
+			subject = relPath
+		}
+		if g.re.MatchString(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// Translates a glob into an anchored regular expression. "*" and "?"
+// never match "/", while "**" matches across path separators.
+func globToRegexp(expr string, ignoreCase bool) (*regexp.Regexp, error) {
+	var re strings.Builder
+	if ignoreCase {
+		re.WriteString("(?i)")
+	}
+	re.WriteString("^")
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch c {
+		case '*':
+			if i+1 < len(expr) && expr[i+1] == '*' {
+				i++
+				// "**/" also matches zero directories
+				if i+1 < len(expr) && expr[i+1] == '/' {
+					i++
+					re.WriteString("(?:.*/)?")
+				} else {
+					re.WriteString(".*")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(expr[i+1:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := expr[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(expr) {
+				i++
+			}
+			re.WriteString(regexp.QuoteMeta(string(expr[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sort orders accepted by Options.Sort
+const (
+	SortName      = "name"
+	SortVersion   = "version"
+	SortSize      = "size"
+	SortMtime     = "mtime"
+	SortCtime     = "ctime"
+	SortExtension = "extension"
+	// Keep the order in which the directory was read
+	SortNone = "none"
+)
+
+// Sort order selected by the options, defaults to name
+func (opts Options) sortOrder() string {
+	if opts.Sort != "" {
+		return opts.Sort
+	}
+	if opts.SortByTime {
+		return SortMtime
+	}
+	return SortName
+}
+
+func validateSort(order string) error {
+	switch order {
+	case SortName, SortVersion, SortSize, SortMtime, SortCtime, SortExtension, SortNone:
+		return nil
+	}
+	return fmt.Errorf("unknown sort order %q", order)
+}
+
+// Sorts the entries of a directory in place
+func sortEntries(files []fs.DirEntry, opts Options) {
+	order := opts.sortOrder()
+	grouped := opts.DirsFirst || opts.FilesFirst
+	if order == SortNone && !grouped {
+		return
+	}
+
+	infos := make(map[string]fs.FileInfo, len(files))
+	if order == SortSize || order == SortMtime || order == SortCtime {
+		for _, file := range files {
+			infos[file.Name()], _ = getFileInfo(file)
+		}
+	}
+	less := entryLess(order, infos)
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		// Group directories and files before comparing
+		if grouped && a.IsDir() != b.IsDir() {
+			return a.IsDir() == opts.DirsFirst
+		}
+		if order == SortNone {
+			return false
+		}
+		if opts.Reverse {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
+
+// Comparison of two entries for the sort order, ties broken by name
+func entryLess(order string, infos map[string]fs.FileInfo) func(a, b fs.DirEntry) bool {
+	byName := func(a, b fs.DirEntry) bool {
+		return a.Name() < b.Name()
+	}
+	switch order {
+	case SortVersion:
+		return func(a, b fs.DirEntry) bool {
+			if c := compareVersions(a.Name(), b.Name()); c != 0 {
+				return c < 0
+			}
+			return byName(a, b)
+		}
+	case SortSize:
+		// Largest first
+		return func(a, b fs.DirEntry) bool {
+			sa, sb := infos[a.Name()].Size(), infos[b.Name()].Size()
+			if sa != sb {
+				return sa > sb
+			}
+			return byName(a, b)
+		}
+	case SortMtime:
+		// Newest first
+		return func(a, b fs.DirEntry) bool {
+			ta, tb := infos[a.Name()].ModTime(), infos[b.Name()].ModTime()
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+			return byName(a, b)
+		}
+	case SortCtime:
+		// Newest first
+		return func(a, b fs.DirEntry) bool {
+			ta, tb := changeTime(infos[a.Name()]), changeTime(infos[b.Name()])
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+			return byName(a, b)
+		}
+	case SortExtension:
+		return func(a, b fs.DirEntry) bool {
+			ea, eb := filepath.Ext(a.Name()), filepath.Ext(b.Name())
+			if ea != eb {
+				return ea < eb
+			}
+			return byName(a, b)
+		}
+	}
+	return byName
+}
+
+// Natural comparison of two names where runs of digits are compared by
+// their numeric value, so "file2" comes before "file10"
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		da, db := isDigit(a[0]), isDigit(b[0])
+		if da && db {
+			var na, nb string
+			na, a = splitDigits(a)
+			nb, b = splitDigits(b)
+			// Compare numbers by length once leading zeros are dropped
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				return len(ta) - len(tb)
+			}
+			if ta != tb {
+				return strings.Compare(ta, tb)
+			}
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Splits the leading run of digits off s
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
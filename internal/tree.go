@@ -2,22 +2,46 @@ package internal
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"go-tree/constant"
-	"os"
-	"strings"
+	"io"
+)
+
+// Output formats supported by Render
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatXML      = "xml"
+	FormatHTML     = "html"
+	FormatYAML     = "yaml"
+	FormatTOML     = "toml"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatMarkdown = "markdown"
+	FormatDot      = "dot"
+	FormatMermaid  = "mermaid"
+	// Newline delimited JSON, one object per entry
+	FormatNDJSON = "ndjson"
 )
 
 type TreeSummary struct {
 	Directories int
 	Files       int
+	// Total size in bytes of the counted entries, only when sizes are
+	// shown. With --du it is the accumulated size of the root directory.
+	Size int64
+	// Number of entries that could not be read
+	Errors int
+	// Reason the scan stopped early, one of the Truncated* constants, empty
+	// when the whole tree is listed
+	Truncated string
 }
 
 type Tree struct {
 	Root    TreeNode
-	Flags   map[string]interface{}
+	Options Options
 	Summary TreeSummary
-	Out     *bytes.Buffer
 }
 
 func NewTreeSummary(noOfDirectories int, noOfFiles int) TreeSummary {
@@ -27,111 +51,163 @@ func NewTreeSummary(noOfDirectories int, noOfFiles int) TreeSummary {
 	}
 }
 
-func NewTree(root TreeNode, flags map[string]interface{}, summary TreeSummary, out *bytes.Buffer) Tree {
+func NewTree(root TreeNode, opts Options, summary TreeSummary) Tree {
 	return Tree{
 		Root:    root,
-		Flags:   flags,
+		Options: opts,
 		Summary: summary,
-		Out:     out,
 	}
 }
 
-// Draws a tree map
-func DrawTree(flags map[string]interface{}) {
-	rootPath := *(flags[constant.Root].(*string))
-	// Check if path is a existing directory with read permission
-	info, err := IsValid(rootPath)
-	if err != nil {
-		return
+// Builds the directory tree rooted at rootPath, or the tree of the
+// archive at rootPath
+func Build(rootPath string, opts Options) (*Tree, error) {
+	return BuildContext(context.Background(), rootPath, opts)
+}
+
+// Builds the tree at rootPath until ctx is done, returning the tree
+// scanned so far flagged as truncated
+func BuildContext(ctx context.Context, rootPath string, opts Options) (*Tree, error) {
+	if isArchive(rootPath, opts) {
+		return buildArchive(ctx, rootPath, opts)
 	}
+	return BuildFSContext(ctx, newDiskFS(rootPath), rootPath, opts)
+}
 
+// Writes the tree to w in the given format
+func Render(w io.Writer, t *Tree, format string) error {
 	var out bytes.Buffer
-	rootNode := NewTreeNode(nil, nil, 0, false, rootPath, info)
-	summary := NewTreeSummary(1, 0)
-	tree := NewTree(rootNode, flags, summary, &out)
-	tree.draw()
+	switch format {
+	case FormatText, "":
+		t.printTree(&out)
+	case FormatJSON:
+		if err := t.printJsonTree(&out); err != nil {
+			return err
+		}
+	case FormatXML:
+		if err := t.printXmlTree(&out); err != nil {
+			return err
+		}
+	case FormatYAML:
+		if err := t.printYamlTree(&out); err != nil {
+			return err
+		}
+	case FormatTOML:
+		if err := t.printTomlTree(&out); err != nil {
+			return err
+		}
+	case FormatCSV:
+		if err := t.printCsvTree(&out, ','); err != nil {
+			return err
+		}
+	case FormatTSV:
+		if err := t.printCsvTree(&out, '\t'); err != nil {
+			return err
+		}
+	case FormatMarkdown:
+		if err := t.printMarkdownTree(&out); err != nil {
+			return err
+		}
+	case FormatDot:
+		if err := t.printDotTree(&out); err != nil {
+			return err
+		}
+	case FormatMermaid:
+		if err := t.printMermaidTree(&out); err != nil {
+			return err
+		}
+	case FormatHTML:
+		t.printHtmlTree(&out)
+	case FormatNDJSON:
+		if err := t.printNDJSONTree(&out); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	_, err := w.Write(out.Bytes())
+	return err
 }
 
-func (t *Tree) draw() {
-	// build directory tree map
-	if err := t.Root.BuildTree(t.Flags, &t.Summary); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// Draws a tree map, stopping the scan when ctx is done
+func DrawTree(ctx context.Context, w io.Writer, rootPath string, opts Options, format string) error {
+	var err error
+	var summary TreeSummary
+	if format == FormatNDJSON && !isArchive(rootPath, opts) {
+		summary, err = stream(ctx, w, rootPath, opts)
+	} else {
+		var tree *Tree
+		if tree, err = BuildContext(ctx, rootPath, opts); err == nil {
+			summary = tree.Summary
+			err = Render(w, tree, format)
+		}
 	}
-
-	indent := ""
-	// draw in xml format
-	if xml := *(t.Flags[constant.XML].(*bool)); xml { // draw in xml format
-		t.Root.drawxml(indent+strings.Repeat(" ", 2), t.Flags, t.Out)
-		t.printXmlTree()
-		return
+	// A root that cannot be listed is drawn alone with its error
+	var invalid *InvalidRootError
+	if errors.As(err, &invalid) {
+		if err := Render(w, invalid.tree(opts), format); err != nil {
+			return err
+		}
+		return &PartialTreeError{Errors: invalid.Summary.Errors}
+	}
+	if err == nil && summary.Truncated != "" {
+		return &TruncatedTreeError{Reason: summary.Truncated}
 	}
-	// draw in json format
-	if json := *(t.Flags[constant.JSON].(*bool)); json {
-		t.Root.drawjson(indent+strings.Repeat(" ", 2), t.Flags, t.Out)
-		t.printJsonTree()
-		return
+	if err == nil && summary.Errors > 0 {
+		return &PartialTreeError{Errors: summary.Errors}
 	}
-	// draw tree map
-	t.Root.draw(indent, t.Flags, t.Out)
-	t.printTree()
-	return
+	return err
 }
 
-func (t *Tree) printTree() {
-	// print tree
-	fmt.Println(t.Out)
-	// print tree summary
-	if justDirs := *(t.Flags[constant.Dir].(*bool)); justDirs {
-		fmt.Printf("%v directories\n", t.Summary.Directories)
-	} else {
-		fmt.Printf("%v directories, %v files\n", t.Summary.Directories, t.Summary.Files)
-	}
+// Error returned by DrawTree after drawing a tree whose scan stopped
+// before the whole tree was listed
+type TruncatedTreeError struct {
+	// One of the Truncated* constants
+	Reason string
 }
 
-func (t *Tree) printXmlTree() {
-	newline := fmt.Sprintf("\n")
-	// print without indentation
-	noIndent := *(t.Flags[constant.Indent].(*bool))
-	if noIndent {
-		newline = ""
-	}
-	fmt.Printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>%s", newline)
-	fmt.Printf("<tree>%s", newline)
-	fmt.Printf("%s", t.Out)
-	// print summary report
-	indent := strings.Repeat(" ", 2)
-	if noIndent {
-		indent = ""
-	}
-	fmt.Printf("%s<report>%s", indent, newline)
-	fmt.Printf("%s<directories>%v</directories>%s", strings.Repeat(indent, 2), t.Summary.Directories, newline)
-	if justDirs := *(t.Flags[constant.Dir].(*bool)); !justDirs {
-		fmt.Printf("%s<files>%v</files>%s", strings.Repeat(indent, 2), t.Summary.Files, newline)
+func (e *TruncatedTreeError) Error() string {
+	return fmt.Sprintf("scan stopped early: %s", e.Reason)
+}
+
+// Error returned by DrawTree after drawing a tree in which some entries
+// could not be read
+type PartialTreeError struct {
+	Errors int
+}
+
+func (e *PartialTreeError) Error() string {
+	return fmt.Sprintf("%d entries could not be read", e.Errors)
+}
+
+func (t *Tree) printTree(out *bytes.Buffer) {
+	// print tree
+	var colors *lsColors
+	if t.Options.Color {
+		colors = loadLSColors()
 	}
-	fmt.Printf("%s</report>%s", indent, newline)
-	fmt.Printf("</tree>\n")
+	t.Root.draw("", t.Options, colors, out)
+	fmt.Fprintln(out)
+	// print tree summary
+	fmt.Fprintln(out, t.summaryLine())
 }
 
-func (t *Tree) printJsonTree() {
-	newline := fmt.Sprintf("\n")
-	// print without indentation
-	noIndent := *(t.Flags[constant.Indent].(*bool))
-	if noIndent {
-		newline = ""
+// Summary line printed after the tree
+func (t *Tree) summaryLine() string {
+	line := ""
+	if t.Options.showSize() {
+		line = fmt.Sprintf("%s used in ", formatTotalSize(t.Summary.Size, t.Options))
+	}
+	if t.Options.DirsOnly {
+		line = fmt.Sprintf("%s%v directories", line, t.Summary.Directories)
+	} else {
+		line = fmt.Sprintf("%s%v directories, %v files", line, t.Summary.Directories, t.Summary.Files)
 	}
-	fmt.Printf("[%s", newline)
-	fmt.Printf("%s%s", t.Out, newline)
-	fmt.Printf(",%s", newline)
-	// print summary report
-	indent := strings.Repeat(" ", 2)
-	if noIndent {
-		indent = ""
+	if t.Summary.Errors > 0 {
+		line = fmt.Sprintf("%s, %v errors", line, t.Summary.Errors)
 	}
-	fmt.Printf("%s{\"type\":\"report\",\"directories\":%v", indent, t.Summary.Directories)
-	if justDirs := *(t.Flags[constant.Dir].(*bool)); !justDirs {
-		fmt.Printf(",\"files\":%v", t.Summary.Files)
+	if t.Summary.Truncated != "" {
+		line = fmt.Sprintf("%s %s", line, truncationMarker(t.Summary.Truncated))
 	}
-	fmt.Printf("}%s", newline)
-	fmt.Printf("]\n")
+	return line
 }
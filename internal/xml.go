@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Document element of the XML output
+type xmlTree struct {
+	XMLName xml.Name  `xml:"tree"`
+	Root    xmlEntry  `xml:"directory"`
+	Report  xmlReport `xml:"report"`
+}
+
+// A directory, file or link element named after the entry type
+type xmlEntry struct {
+	XMLName   xml.Name
+	Name      string `xml:"name,attr"`
+	Target    string `xml:"target,attr,omitempty"`
+	Broken    bool   `xml:"broken,attr,omitempty"`
+	Recursive bool   `xml:"recursive,attr,omitempty"`
+	Mode      string `xml:"mode,attr,omitempty"`
+	Prot      string `xml:"prot,attr,omitempty"`
+	Size      *int64 `xml:"size,attr,omitempty"`
+	// Reason the entry could not be read
+	Error    string     `xml:"error,omitempty"`
+	Contents []xmlEntry `xml:",any"`
+}
+
+// The summary report closing the XML output
+type xmlReport struct {
+	Directories int    `xml:"directories"`
+	Files       *int   `xml:"files,omitempty"`
+	Size        *int64 `xml:"size,omitempty"`
+	Errors      int    `xml:"errors,omitempty"`
+	Truncated   string `xml:"truncated,omitempty"`
+}
+
+// Prints the directory tree in XML format, see tree/tree.xsd for the schema
+func (t *Tree) printXmlTree(out io.Writer) error {
+	newline := "\n"
+	// print without indentation
+	if t.Options.NoIndent {
+		newline = ""
+	}
+	fmt.Fprintf(out, "%s%s", strings.TrimSuffix(xml.Header, "\n"), newline)
+	encoder := xml.NewEncoder(out)
+	if !t.Options.NoIndent {
+		encoder.Indent("", "  ")
+	}
+	if err := encoder.Encode(xmlTree{Root: t.Root.xmlEntry(t.Options), Report: t.xmlReport()}); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// Converts the node and its children to XML elements
+func (node *TreeNode) xmlEntry(opts Options) xmlEntry {
+	entry := xmlEntry{
+		XMLName: xml.Name{Local: getFileType(node.Info)},
+		Name:    node.Info.Name(),
+	}
+	if opts.FullPath || node.Root == nil {
+		entry.Name = node.Path
+	}
+	if node.isLink() {
+		entry.Target = node.Target
+		entry.Broken = node.isBrokenLink()
+		entry.Recursive = node.Recursive
+	}
+	if opts.Permission {
+		entry.Mode = fmt.Sprintf("%04o", node.Info.Mode().Perm())
+		entry.Prot = node.Info.Mode().String()
+	}
+	if opts.showSize() {
+		size := node.Size
+		entry.Size = &size
+	}
+	entry.Error = node.errorText()
+	for _, child := range node.Children {
+		entry.Contents = append(entry.Contents, child.xmlEntry(opts))
+	}
+	return entry
+}
+
+func (t *Tree) xmlReport() xmlReport {
+	report := xmlReport{Directories: t.Summary.Directories, Errors: t.Summary.Errors, Truncated: t.Summary.Truncated}
+	if !t.Options.DirsOnly {
+		files := t.Summary.Files
+		report.Files = &files
+	}
+	if t.Options.showSize() {
+		size := t.Summary.Size
+		report.Size = &size
+	}
+	return report
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"io"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// The TOML document, which cannot hold a top level array like the JSON
+// and YAML outputs
+type tomlTree struct {
+	Tree   jsonEntry  `toml:"tree"`
+	Report jsonReport `toml:"report"`
+}
+
+// Prints the directory tree in YAML format: a sequence holding the root
+// entry followed by the summary report, in flow style without indentation
+func (t *Tree) printYamlTree(out io.Writer) error {
+	var doc yaml.Node
+	if err := doc.Encode([]interface{}{t.Root.jsonEntry(t.Options), t.jsonReport()}); err != nil {
+		return err
+	}
+	// print without indentation
+	if t.Options.NoIndent {
+		doc.Style = yaml.FlowStyle
+	}
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Prints the directory tree in TOML format: a "tree" table holding the
+// root entry and a "report" table, with inline tables without indentation
+func (t *Tree) printTomlTree(out io.Writer) error {
+	encoder := toml.NewEncoder(out)
+	// print without indentation
+	if t.Options.NoIndent {
+		encoder.SetTablesInline(true)
+	} else {
+		encoder.SetIndentTables(true)
+	}
+	return encoder.Encode(tomlTree{Tree: t.Root.jsonEntry(t.Options), Report: t.jsonReport()})
+}
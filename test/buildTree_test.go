@@ -1,43 +1,45 @@
 package test
 
 import (
-	"bytes"
-	"go-tree/constant"
 	"go-tree/internal"
 	"os"
-
-	"github.com/spf13/cobra"
+	"time"
 )
 
-func getDefaultFlags() map[string]interface{} {
-	var flags map[string]interface{}
-	var goTree = &cobra.Command{
-		Use:   "./main",
-		Short: "unix command \"tree\" implementation in go",
-		Long:  "go-tree is a cli tool which draws a tree of directory structure",
-		Run: func(cmd *cobra.Command, args []string) {
-			internal.DrawTree(flags)
-		},
-	}
-	flags = map[string]interface{}{}
-	flags[constant.Root] = goTree.PersistentFlags().StringP(constant.Root, "r", ".", "Root path of the tree")
-	flags[constant.Path] = goTree.PersistentFlags().BoolP(constant.Path, "f", false, "Flag to show fullpaths")
-	flags[constant.Dir] = goTree.PersistentFlags().BoolP(constant.Dir, "d", false, "Flag to only list directories")
-	flags[constant.Level] = goTree.PersistentFlags().IntP(constant.Level, "L", 0, "Max level of tree depth")
-	flags[constant.Permission] = goTree.PersistentFlags().BoolP(constant.Permission, "p", false, "Flag to show permission modes")
-	flags[constant.Time] = goTree.PersistentFlags().BoolP(constant.Time, "t", false, "Flag to sort output by modified time")
-	flags[constant.JSON] = goTree.PersistentFlags().BoolP(constant.JSON, "J", false, "Prints tree in JSON format")
-	flags[constant.XML] = goTree.PersistentFlags().BoolP(constant.XML, "X", false, "Prints tree in XML format")
-	return flags
+func getDefaultOptions() internal.Options {
+	return internal.Options{}
 }
 
 func newTree() internal.Tree {
 	root := "."
 	info, _ := os.Stat(root)
 	rootNode := internal.NewTreeNode(nil, nil, 0, false, root, info)
-	flags := getDefaultFlags()
+	opts := getDefaultOptions()
 	summary := internal.NewTreeSummary(1, 0)
-	var out bytes.Buffer
-	tree := internal.NewTree(rootNode, flags, summary, &out)
+	tree := internal.NewTree(rootNode, opts, summary)
 	return tree
 }
+
+// Minimal os.FileInfo for building trees without touching the filesystem
+type fakeFileInfo struct {
+	name string
+	mode os.FileMode
+	size int64
+}
+
+func (info fakeFileInfo) Name() string       { return info.name }
+func (info fakeFileInfo) Size() int64        { return info.size }
+func (info fakeFileInfo) Mode() os.FileMode  { return info.mode }
+func (info fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (info fakeFileInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info fakeFileInfo) Sys() interface{}   { return nil }
+
+// Tree of a root directory holding a directory and a file with the given name
+func newFakeTree(name string, opts internal.Options) internal.Tree {
+	root := internal.NewTreeNode(nil, nil, 0, false, "root", fakeFileInfo{name: "root", mode: os.ModeDir | 0755})
+	dir := internal.NewTreeNode(&root, nil, 1, false, name, fakeFileInfo{name: name, mode: os.ModeDir | 0755})
+	file := internal.NewTreeNode(&dir, nil, 2, true, name, fakeFileInfo{name: name, mode: 0644, size: 42})
+	dir.Children = []internal.TreeNode{file}
+	root.Children = []internal.TreeNode{dir}
+	return internal.NewTree(root, opts, internal.NewTreeSummary(2, 1))
+}
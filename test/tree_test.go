@@ -1,10 +1,31 @@
 package test
 
 import (
-	"go-tree/constant"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"go-tree/internal"
+	"go-tree/tree"
+	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 	// Replace with your package import path
 )
 
@@ -24,7 +45,7 @@ func TestTree(t *testing.T) {
 		defer os.RemoveAll(dir)
 
 		// Call the BuildTree function
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		// Add assertions for the expected output
 		expected := internal.NewTreeSummary(2, 3)
 		// Check if the output matches the expected summary
@@ -33,28 +54,25 @@ func TestTree(t *testing.T) {
 		}
 
 		// has only directories tag
-		val := true
-		tree.Flags[constant.Dir] = &val
+		tree.Options.DirsOnly = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for empty directory with dir tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// sorted by date modified
-		m := true
-		tree.Flags[constant.Time] = &m
+		tree.Options.SortByTime = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for empty directory with date modified tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// has level tag
-		l := 1
-		tree.Flags[constant.Level] = &l
+		tree.Options.Level = 1
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		expected = internal.NewTreeSummary(2, 3)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for empty directory with level tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
@@ -70,7 +88,7 @@ func TestTree(t *testing.T) {
 		defer os.RemoveAll(dir)
 
 		// Call the BuildTree function
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		// Add assertions for the expected output
 		expected := internal.NewTreeSummary(4, 3)
 		// Check if the output matches the expected summary
@@ -79,28 +97,25 @@ func TestTree(t *testing.T) {
 		}
 
 		// only directories tag
-		val := true
-		tree.Flags[constant.Dir] = &val
+		tree.Options.DirsOnly = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for nested empty directories with dir tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// sorted by date modified
-		m := true
-		tree.Flags[constant.Time] = &m
+		tree.Options.SortByTime = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for nested empty directories with date modified tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// if has level tag
-		l := 2
-		tree.Flags[constant.Level] = &l
+		tree.Options.Level = 2
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		expected = internal.NewTreeSummary(3, 3)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for nested empty directories with level tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
@@ -117,7 +132,7 @@ func TestTree(t *testing.T) {
 		defer os.RemoveAll(dir)
 
 		// Call the BuildTree function
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		// Add assertions for the expected output
 		expected := internal.NewTreeSummary(2, 13)
 		// Check if the output matches the expected summary
@@ -126,28 +141,25 @@ func TestTree(t *testing.T) {
 		}
 
 		// only directories tag
-		val := true
-		tree.Flags[constant.Dir] = &val
+		tree.Options.DirsOnly = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with multiple files and dir tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// sorted by date modified
-		m := true
-		tree.Flags[constant.Time] = &m
+		tree.Options.SortByTime = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with multiple files and date modified tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// if has level tag
-		l := 1
-		tree.Flags[constant.Level] = &l
+		tree.Options.Level = 1
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		expected = internal.NewTreeSummary(2, 3)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with multiple files and level tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
@@ -163,40 +175,1424 @@ func TestTree(t *testing.T) {
 		defer os.RemoveAll(dir)
 
 		// Call the BuildTree function
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		// Add assertions for the expected output
 		expected := internal.NewTreeSummary(3, 3)
+		// The subdirectory cannot be listed unless running as root
+		if os.Geteuid() != 0 {
+			expected.Errors = 1
+		}
 		// Check if the output matches the expected summary
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with permission issue: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// only directories tag
-		val := true
-		tree.Flags[constant.Dir] = &val
+		tree.Options.DirsOnly = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with permission issue and directory tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// sorted by date modified
-		m := true
-		tree.Flags[constant.Time] = &m
+		tree.Options.SortByTime = true
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with permission issue and date modified tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 
 		// if has level tag
-		l := 1
-		tree.Flags[constant.Level] = &l
+		tree.Options.Level = 1
 		tree.Summary = internal.NewTreeSummary(1, 0)
-		tree.Root.BuildTree(tree.Flags, &tree.Summary)
+		tree.Root.BuildTree(tree.Options, &tree.Summary)
 		expected = internal.NewTreeSummary(2, 3)
 		if tree.Summary != expected {
 			t.Errorf("BuildTree() for directory with permission issue and level tag: \n output = %#v\n expected = %#v\n", tree.Summary, expected)
 		}
 	})
 }
+
+func TestBuildAndRender(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"subdir/": "", "file.txt": ""})
+
+	tr, err := tree.Build(dir, tree.Options{})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	expected := internal.NewTreeSummary(2, 1)
+	if tr.Summary != expected {
+		t.Errorf("Build(): \n output = %#v\n expected = %#v\n", tr.Summary, expected)
+	}
+
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := dir + "\n├── file.txt\n└── subdir\n\n2 directories, 1 files\n"
+	if out.String() != want {
+		t.Errorf("Render(): \n output = %q\n expected = %q\n", out.String(), want)
+	}
+
+	// unknown format
+	if err := tree.Render(&out, tr, "unknown"); err == nil {
+		t.Errorf("Render() with unknown format: expected an error")
+	}
+
+	// invalid root
+	if _, err := tree.Build(filepath.Join(dir, "missing"), tree.Options{}); err == nil {
+		t.Errorf("Build() with missing root: expected an error")
+	}
+}
+
+func TestHiddenEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{".github/": "", ".env.example": "", "main.go": ""})
+
+	// hidden entries skipped by default
+	tr, err := tree.Build(dir, tree.Options{})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	expected := internal.NewTreeSummary(1, 1)
+	if tr.Summary != expected {
+		t.Errorf("Build() without all tag: \n output = %#v\n expected = %#v\n", tr.Summary, expected)
+	}
+
+	// has all tag
+	tr, err = tree.Build(dir, tree.Options{All: true})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	expected = internal.NewTreeSummary(2, 2)
+	if tr.Summary != expected {
+		t.Errorf("Build() with all tag: \n output = %#v\n expected = %#v\n", tr.Summary, expected)
+	}
+	if len(tr.Root.Children) != 3 {
+		t.Errorf("Build() with all tag: expected 3 entries, got %v", len(tr.Root.Children))
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"src/main.go":         "",
+		"src/README.md":       "",
+		"vendor/lib/lib.go":   "",
+		"node_modules/pkg.js": "",
+		"Makefile":            "",
+	})
+
+	tests := []struct {
+		name     string
+		opts     tree.Options
+		expected internal.TreeSummary
+	}{
+		{"include", tree.Options{Pattern: "*.go"}, internal.NewTreeSummary(5, 2)},
+		{"include alternatives", tree.Options{Pattern: "*.go|Makefile"}, internal.NewTreeSummary(5, 3)},
+		{"include ignore case", tree.Options{Pattern: "*.MD", IgnoreCase: true}, internal.NewTreeSummary(5, 1)},
+		{"include doublestar", tree.Options{Pattern: "vendor/**/*.go"}, internal.NewTreeSummary(5, 1)},
+		{"include matchdirs", tree.Options{Pattern: "src", MatchDirs: true}, internal.NewTreeSummary(5, 2)},
+		{"exclude", tree.Options{Exclude: "node_modules|vendor"}, internal.NewTreeSummary(2, 3)},
+		{"exclude and include", tree.Options{Exclude: "vendor", Pattern: "*.go"}, internal.NewTreeSummary(3, 1)},
+	}
+	for _, tc := range tests {
+		tr, err := tree.Build(dir, tc.opts)
+		if err != nil {
+			t.Fatalf("Build() with %s pattern returned error: %v", tc.name, err)
+		}
+		if tr.Summary != tc.expected {
+			t.Errorf("Build() with %s pattern: \n output = %#v\n expected = %#v\n", tc.name, tr.Summary, tc.expected)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".git/info/exclude":  "secret\n",
+		".gitignore":         "# build outputs\n*.log\nbuild/\n/top.txt\n!important.log\ndocs/**/*.tmp\n",
+		"src/gen/.gitignore": "*\n!*.go\n",
+		"a.log":              "",
+		"important.log":      "",
+		"top.txt":            "",
+		"secret":             "",
+		"build/out":          "",
+		"src/top.txt":        "",
+		"src/gen/a.go":       "",
+		"src/gen/b.txt":      "",
+		"docs/a.tmp":         "",
+		"docs/x/y.tmp":       "",
+		"docs/ok.md":         "",
+	})
+
+	tr, err := tree.Build(dir, tree.Options{GitIgnore: true})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := dir + `
+├── docs
+│   ├── ok.md
+│   └── x
+├── important.log
+└── src
+    ├── gen
+    │   └── a.go
+    └── top.txt
+
+5 directories, 4 files
+`
+	if out.String() != want {
+		t.Errorf("Render() with gitignore tag: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// gitignore files of the enclosing repository apply below the root
+	tr, err = tree.Build(filepath.Join(dir, "docs"), tree.Options{GitIgnore: true})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	expected := internal.NewTreeSummary(2, 1)
+	if tr.Summary != expected {
+		t.Errorf("Build() of repository subdirectory with gitignore tag: \n output = %#v\n expected = %#v\n", tr.Summary, expected)
+	}
+
+	// submodules and worktrees have a .git file pointing to the repository
+	main := t.TempDir()
+	writeTree(t, main, map[string]string{
+		".git/info/exclude":             "secret\n",
+		".git/modules/sub/info/exclude": "private\n",
+		".git/worktrees/wt/commondir":   "../..\n",
+		"sub/.git":                      "gitdir: ../.git/modules/sub\n",
+		"sub/private":                   "",
+		"sub/dir/private":               "",
+		"sub/dir/file":                  "",
+	})
+	wt := t.TempDir()
+	writeTree(t, wt, map[string]string{
+		".git":       "gitdir: " + filepath.Join(main, ".git", "worktrees", "wt") + "\n",
+		"secret":     "",
+		"dir/secret": "",
+		"dir/file":   "",
+	})
+	roots := map[string]string{
+		filepath.Join(main, "sub"):        "\n└── dir\n    └── file\n\n2 directories, 1 files\n",
+		filepath.Join(main, "sub", "dir"): "\n└── file\n\n1 directories, 1 files\n",
+		wt:                                "\n└── dir\n    └── file\n\n2 directories, 1 files\n",
+	}
+	for root, want := range roots {
+		var out bytes.Buffer
+		if err := tree.Draw(&out, root, tree.Options{GitIgnore: true}, tree.FormatText); err != nil {
+			t.Fatalf("Draw() of a checkout with a .git file returned error: %v", err)
+		}
+		if out.String() != root+want {
+			t.Errorf("Draw() of a checkout with a .git file: \n output = %s\n expected = %s\n", out.String(), root+want)
+		}
+	}
+}
+
+func TestSizes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"small.txt":  strings.Repeat("x", 100),
+		"medium.bin": strings.Repeat("x", 2048),
+		"large.bin":  strings.Repeat("x", 1500000),
+	})
+
+	tests := []struct {
+		name     string
+		opts     tree.Options
+		expected string
+	}{
+		{"bytes", tree.Options{Size: true}, `
+├── [    1500000] large.bin
+├── [       2048] medium.bin
+└── [        100] small.txt
+
+1502148 bytes used in 1 directories, 3 files
+`},
+		{"human", tree.Options{Human: true}, `
+├── [1.4M] large.bin
+├── [2.0K] medium.bin
+└── [ 100] small.txt
+
+1.4M used in 1 directories, 3 files
+`},
+		{"si", tree.Options{SI: true}, `
+├── [1.5M] large.bin
+├── [2.0K] medium.bin
+└── [ 100] small.txt
+
+1.5M used in 1 directories, 3 files
+`},
+	}
+	for _, tc := range tests {
+		tr, err := tree.Build(dir, tc.opts)
+		if err != nil {
+			t.Fatalf("Build() with %s tag returned error: %v", tc.name, err)
+		}
+		var out bytes.Buffer
+		if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+			t.Fatalf("Render() with %s tag returned error: %v", tc.name, err)
+		}
+		if want := dir + tc.expected; out.String() != want {
+			t.Errorf("Render() with %s tag: \n output = %s\n expected = %s\n", tc.name, out.String(), want)
+		}
+		if tr.Summary.Size != 1502148 {
+			t.Errorf("Build() with %s tag: total size = %v, expected 1502148", tc.name, tr.Summary.Size)
+		}
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a/one.bin":   strings.Repeat("x", 1000),
+		"a/b/two.bin": strings.Repeat("x", 2000),
+		"a/b/c/x.go":  strings.Repeat("x", 3000),
+		"a/skip.log":  strings.Repeat("x", 500),
+	})
+	dirSize := func(parts ...string) int64 {
+		info, err := os.Stat(filepath.Join(append([]string{dir}, parts...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	sizeOfC := dirSize("a", "b", "c") + 3000
+	sizeOfB := dirSize("a", "b") + 2000 + sizeOfC
+	sizeOfA := dirSize("a") + 1000 + sizeOfB
+	total := dirSize() + sizeOfA
+
+	// level limited subtrees are still accumulated, excluded ones are not
+	for _, level := range []int{0, 2} {
+		tr, err := tree.Build(dir, tree.Options{DiskUsage: true, Level: level, Exclude: "*.log"})
+		if err != nil {
+			t.Fatalf("Build() with du tag returned error: %v", err)
+		}
+		a := tr.Root.Children[0]
+		b := a.Children[0]
+		if a.Size != sizeOfA || b.Size != sizeOfB {
+			t.Errorf("Build() with du tag and level %v: sizes = %v, %v, expected %v, %v", level, a.Size, b.Size, sizeOfA, sizeOfB)
+		}
+		if tr.Summary.Size != total {
+			t.Errorf("Build() with du tag and level %v: total size = %v, expected %v", level, tr.Summary.Size, total)
+		}
+	}
+
+	// subtrees past the level are measured beyond the max entries
+	tr, err := tree.Build(dir, tree.Options{DiskUsage: true, Level: 1, Exclude: "*.log", MaxEntries: 1})
+	if err != nil {
+		t.Fatalf("Build() with du tag returned error: %v", err)
+	}
+	if a := tr.Root.Children[0]; a.Size != sizeOfA || tr.Summary.Truncated != "" {
+		t.Errorf("Build() with du tag and max entries: size = %v, truncated = %q, expected %v, \"\"", a.Size, tr.Summary.Truncated, sizeOfA)
+	}
+}
+
+func TestColors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"sub/": "", "main.go": "", "run.sh": "", "notes.txt": ""})
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LS_COLORS", "di=01;34:ex=01;32:*.go=36")
+
+	tr, err := tree.Build(dir, tree.Options{Color: true})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "\x1b[01;34m" + dir + "\x1b[0m\n" +
+		"├── \x1b[36mmain.go\x1b[0m\n" +
+		"├── notes.txt\n" +
+		"├── \x1b[01;32mrun.sh\x1b[0m\n" +
+		"└── \x1b[01;34msub\x1b[0m\n" +
+		"\n2 directories, 3 files\n"
+	if out.String() != want {
+		t.Errorf("Render() with color tag: \n output = %q\n expected = %q\n", out.String(), want)
+	}
+
+	// output to a buffer is never colorized automatically
+	if tree.AutoColor(&out) {
+		t.Errorf("AutoColor() for a buffer: expected false")
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/f": ""})
+	links := map[string]string{
+		filepath.Join("a", "up"): "..",
+		"broken":                 "missing",
+		"link":                   "a",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symbolic links not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		opts     tree.Options
+		expected string
+	}{
+		{"not followed", tree.Options{}, `
+├── a
+│   ├── f
+│   └── up -> ..
+├── broken -> missing    [broken link]
+└── link -> a
+
+2 directories, 4 files
+`},
+		{"followed", tree.Options{FollowLinks: true}, `
+├── a
+│   ├── f
+│   └── up -> ..    [recursive, not followed]
+├── broken -> missing    [broken link]
+└── link -> a
+    ├── f
+    └── up -> ..    [recursive, not followed]
+
+5 directories, 3 files
+`},
+	}
+	for _, tc := range tests {
+		tr, err := tree.Build(dir, tc.opts)
+		if err != nil {
+			t.Fatalf("Build() with links %s returned error: %v", tc.name, err)
+		}
+		var out bytes.Buffer
+		if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+			t.Fatalf("Render() with links %s returned error: %v", tc.name, err)
+		}
+		if want := dir + tc.expected; out.String() != want {
+			t.Errorf("Render() with links %s: \n output = %s\n expected = %s\n", tc.name, out.String(), want)
+		}
+	}
+}
+
+func TestSortOrders(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"bdir/":      "",
+		"file10.txt": strings.Repeat("x", 10),
+		"file2.txt":  strings.Repeat("x", 30),
+		"a.md":       strings.Repeat("x", 20),
+	})
+
+	tests := []struct {
+		name     string
+		opts     tree.Options
+		expected []string
+	}{
+		{"name", tree.Options{}, []string{"a.md", "bdir", "file10.txt", "file2.txt"}},
+		{"reverse name", tree.Options{Reverse: true}, []string{"file2.txt", "file10.txt", "bdir", "a.md"}},
+		{"version", tree.Options{Sort: tree.SortVersion}, []string{"a.md", "bdir", "file2.txt", "file10.txt"}},
+		{"extension", tree.Options{Sort: tree.SortExtension}, []string{"bdir", "a.md", "file10.txt", "file2.txt"}},
+		{"dirsfirst", tree.Options{Sort: tree.SortVersion, DirsFirst: true}, []string{"bdir", "a.md", "file2.txt", "file10.txt"}},
+		{"filesfirst", tree.Options{FilesFirst: true}, []string{"a.md", "file10.txt", "file2.txt", "bdir"}},
+		{"size", tree.Options{Sort: tree.SortSize, FilesFirst: true}, []string{"file2.txt", "a.md", "file10.txt", "bdir"}},
+	}
+	for _, tc := range tests {
+		tr, err := tree.Build(dir, tc.opts)
+		if err != nil {
+			t.Fatalf("Build() sorted by %s returned error: %v", tc.name, err)
+		}
+		names := []string{}
+		for _, child := range tr.Root.Children {
+			names = append(names, filepath.Base(child.Path))
+		}
+		if strings.Join(names, " ") != strings.Join(tc.expected, " ") {
+			t.Errorf("Build() sorted by %s: \n output = %v\n expected = %v\n", tc.name, names, tc.expected)
+		}
+	}
+
+	if _, err := tree.Build(dir, tree.Options{Sort: "unknown"}); err == nil {
+		t.Errorf("Build() with unknown sort order: expected an error")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"docs/a&b <c>.txt": ""})
+
+	tr, err := tree.Build(dir, tree.Options{HTMLBase: "https://ci.example/run/", HTMLTitle: "Artifacts"})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatHTML); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	for _, want := range []string{
+		"<title>Artifacts</title>",
+		"<a href=\"https://ci.example/run/\">" + dir + "</a>\n",
+		"└── <a href=\"https://ci.example/run/docs/\">docs</a>\n",
+		"    └── <a href=\"https://ci.example/run/docs/a&amp;b%20%3Cc%3E.txt\">a&amp;b &lt;c&gt;.txt</a>\n",
+		"<p class=\"report\">2 directories, 1 files</p>",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Render() in HTML format: output does not contain %q\n output = %s", want, out.String())
+		}
+	}
+}
+
+func FuzzJSONOutput(f *testing.F) {
+	for _, name := range []string{"file.txt", "quote\"d", `back\slash`, "100%s", "tab\tnew\nline", "<&>", "\x00\x1f"} {
+		f.Add(name, false)
+	}
+	f.Fuzz(func(t *testing.T, name string, noIndent bool) {
+		tr := newFakeTree(name, internal.Options{NoIndent: noIndent, Permission: true, Size: true})
+		var out bytes.Buffer
+		if err := tree.Render(&out, &tr, tree.FormatJSON); err != nil {
+			t.Fatalf("Render() returned error: %v", err)
+		}
+		var parsed []map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &parsed); err != nil {
+			t.Fatalf("Render() in JSON format produced invalid JSON for %q: %v\n%s", name, err, out.String())
+		}
+		if len(parsed) != 2 || parsed[1]["type"] != "report" {
+			t.Fatalf("Render() in JSON format: expected tree and report, got %v", parsed)
+		}
+		if !utf8.ValidString(name) {
+			return
+		}
+		dir := parsed[0]["contents"].([]interface{})[0].(map[string]interface{})
+		file := dir["contents"].([]interface{})[0].(map[string]interface{})
+		if dir["name"] != name || file["name"] != name {
+			t.Errorf("Render() in JSON format: names = %q, %q, expected %q", dir["name"], file["name"], name)
+		}
+	})
+}
+
+func TestXMLOutput(t *testing.T) {
+	type entry struct {
+		XMLName  xml.Name
+		Name     string  `xml:"name,attr"`
+		Size     int64   `xml:"size,attr"`
+		Contents []entry `xml:",any"`
+	}
+	type document struct {
+		Root   entry `xml:"directory"`
+		Report struct {
+			Directories int `xml:"directories"`
+			Files       int `xml:"files"`
+		} `xml:"report"`
+	}
+
+	for _, name := range []string{"a&b", "<tag>", `"quoted" 'name'`, "100%s"} {
+		for _, noIndent := range []bool{false, true} {
+			tr := newFakeTree(name, internal.Options{NoIndent: noIndent, Size: true})
+			var out bytes.Buffer
+			if err := tree.Render(&out, &tr, tree.FormatXML); err != nil {
+				t.Fatalf("Render() returned error: %v", err)
+			}
+			var doc document
+			if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+				t.Fatalf("Render() in XML format produced invalid XML for %q: %v\n%s", name, err, out.String())
+			}
+			dir := doc.Root.Contents[0]
+			file := dir.Contents[0]
+			if dir.XMLName.Local != "directory" || file.XMLName.Local != "file" {
+				t.Errorf("Render() in XML format: elements = %v, %v", dir.XMLName.Local, file.XMLName.Local)
+			}
+			if dir.Name != name || file.Name != name || file.Size != 42 {
+				t.Errorf("Render() in XML format: names = %q, %q, expected %q", dir.Name, file.Name, name)
+			}
+			if doc.Report.Directories != 2 || doc.Report.Files != 1 {
+				t.Errorf("Render() in XML format: report = %+v", doc.Report)
+			}
+		}
+	}
+	if !strings.Contains(tree.XMLSchema, "<xs:schema") {
+		t.Errorf("XMLSchema does not hold an XSD")
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/b/c.txt": "data", "a/d.txt": "data", "e.txt": "data"})
+
+	var streamed bytes.Buffer
+	if err := tree.Stream(&streamed, dir, tree.Options{}); err != nil {
+		t.Fatalf("Stream() returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(streamed.String(), "\n"), "\n")
+	expected := []struct {
+		path   string
+		depth  int
+		parent string
+	}{
+		{dir, 0, ""},
+		{filepath.Join(dir, "a"), 1, dir},
+		{filepath.Join(dir, "a", "b"), 2, filepath.Join(dir, "a")},
+		{filepath.Join(dir, "a", "b", "c.txt"), 3, filepath.Join(dir, "a", "b")},
+		{filepath.Join(dir, "a", "d.txt"), 2, filepath.Join(dir, "a")},
+		{filepath.Join(dir, "e.txt"), 1, dir},
+	}
+	if len(lines) != len(expected)+1 {
+		t.Fatalf("Stream(): expected %v lines, got %v\n%s", len(expected)+1, len(lines), streamed.String())
+	}
+	for i, want := range expected {
+		var entry struct {
+			Path   string `json:"path"`
+			Depth  int    `json:"depth"`
+			Parent string `json:"parent"`
+			Size   int64  `json:"size"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("Stream() produced invalid JSON line %q: %v", lines[i], err)
+		}
+		if entry.Path != want.path || entry.Depth != want.depth || entry.Parent != want.parent {
+			t.Errorf("Stream() line %v: \n output = %+v\n expected = %+v\n", i, entry, want)
+		}
+	}
+	if want := `{"type":"report","directories":3,"files":3}`; lines[len(lines)-1] != want {
+		t.Errorf("Stream() report: \n output = %s\n expected = %s\n", lines[len(lines)-1], want)
+	}
+
+	// rendering a built tree gives the same output, with directory sizes
+	// accumulated by --du
+	for _, opts := range []tree.Options{{}, {DiskUsage: true}} {
+		streamed.Reset()
+		if err := tree.Stream(&streamed, dir, opts); err != nil {
+			t.Fatalf("Stream() returned error: %v", err)
+		}
+		tr, err := tree.Build(dir, opts)
+		if err != nil {
+			t.Fatalf("Build() returned error: %v", err)
+		}
+		var rendered bytes.Buffer
+		if err := tree.Render(&rendered, tr, tree.FormatNDJSON); err != nil {
+			t.Fatalf("Render() returned error: %v", err)
+		}
+		if rendered.String() != streamed.String() {
+			t.Errorf("Render() in NDJSON format with du tag %v: \n output = %s\n expected = %s\n", opts.DiskUsage, rendered.String(), streamed.String())
+		}
+	}
+}
+
+func TestYAMLAndTOMLOutput(t *testing.T) {
+	type entry struct {
+		Type     string  `yaml:"type" toml:"type"`
+		Name     string  `yaml:"name" toml:"name"`
+		Size     int64   `yaml:"size" toml:"size"`
+		Contents []entry `yaml:"contents" toml:"contents"`
+	}
+	type report struct {
+		Directories int `yaml:"directories" toml:"directories"`
+		Files       int `yaml:"files" toml:"files"`
+	}
+
+	for _, name := range []string{"plain", "key: value", "- item", "'quoted' \"name\"", "#hash", "multi\nline"} {
+		for _, noIndent := range []bool{false, true} {
+			tr := newFakeTree(name, internal.Options{NoIndent: noIndent, Size: true})
+
+			var out bytes.Buffer
+			if err := tree.Render(&out, &tr, tree.FormatYAML); err != nil {
+				t.Fatalf("Render() in YAML format returned error: %v", err)
+			}
+			var doc []yaml.Node
+			if err := yaml.Unmarshal(out.Bytes(), &doc); err != nil || len(doc) != 2 {
+				t.Fatalf("Render() in YAML format produced invalid YAML for %q: %v\n%s", name, err, out.String())
+			}
+			var root entry
+			var rep report
+			if err := doc[0].Decode(&root); err != nil {
+				t.Fatal(err)
+			}
+			if err := doc[1].Decode(&rep); err != nil {
+				t.Fatal(err)
+			}
+			if root.Contents[0].Name != name || root.Contents[0].Contents[0].Size != 42 || rep != (report{2, 1}) {
+				t.Errorf("Render() in YAML format for %q: \n output = %s", name, out.String())
+			}
+
+			out.Reset()
+			if err := tree.Render(&out, &tr, tree.FormatTOML); err != nil {
+				t.Fatalf("Render() in TOML format returned error: %v", err)
+			}
+			var tomlDoc struct {
+				Tree   entry  `toml:"tree"`
+				Report report `toml:"report"`
+			}
+			if err := toml.Unmarshal(out.Bytes(), &tomlDoc); err != nil {
+				t.Fatalf("Render() in TOML format produced invalid TOML for %q: %v\n%s", name, err, out.String())
+			}
+			if tomlDoc.Tree.Contents[0].Name != name || tomlDoc.Tree.Contents[0].Contents[0].Size != 42 || tomlDoc.Report != (report{2, 1}) {
+				t.Errorf("Render() in TOML format for %q: \n output = %s", name, out.String())
+			}
+		}
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	name := "a \"quoted\", name\nwith newline"
+	tr := newFakeTree(name, internal.Options{
+		Columns:    []string{tree.ColumnName, tree.ColumnDepth, tree.ColumnType, tree.ColumnSize},
+		CSVSummary: true,
+	})
+
+	for _, format := range []string{tree.FormatCSV, tree.FormatTSV} {
+		var out bytes.Buffer
+		if err := tree.Render(&out, &tr, format); err != nil {
+			t.Fatalf("Render() in %s format returned error: %v", format, err)
+		}
+		reader := csv.NewReader(&out)
+		if format == tree.FormatTSV {
+			reader.Comma = '\t'
+		}
+		rows, err := reader.ReadAll()
+		if err != nil {
+			t.Fatalf("Render() in %s format produced an invalid table: %v", format, err)
+		}
+		expected := [][]string{
+			{"name", "depth", "type", "size"},
+			{"root", "0", "directory", "0"},
+			{name, "1", "directory", "0"},
+			{name, "2", "file", "42"},
+			{"2 directories, 1 files", "", "", ""},
+		}
+		if fmt.Sprint(rows) != fmt.Sprint(expected) {
+			t.Errorf("Render() in %s format: \n output = %q\n expected = %q\n", format, rows, expected)
+		}
+	}
+
+	tr.Options.Columns = []string{"unknown"}
+	if err := tree.Render(&bytes.Buffer{}, &tr, tree.FormatCSV); err == nil {
+		t.Errorf("Render() with unknown column: expected an error")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"docs/my_guide (v2).md": "", "main.go": ""})
+	sidecar := filepath.Join(t.TempDir(), "descriptions.txt")
+	if err := os.WriteFile(sidecar, []byte("# entry descriptions\ndocs/: Documentation\nmain.go: Entry point\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	descriptions, err := tree.ReadDescriptions(sidecar)
+	if err != nil {
+		t.Fatalf("ReadDescriptions() returned error: %v", err)
+	}
+
+	tr, err := tree.Build(dir, tree.Options{MarkdownStyle: tree.MarkdownList, Descriptions: descriptions})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatMarkdown); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "- [docs/](docs/) - Documentation\n" +
+		"  - [my\\_guide (v2).md](docs/my_guide%20%28v2%29.md)\n" +
+		"- [main.go](main.go) - Entry point\n" +
+		"\n2 directories, 2 files\n"
+	if out.String() != want {
+		t.Errorf("Render() as Markdown list: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// fenced code block
+	tr.Options.MarkdownStyle = tree.MarkdownCode
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatMarkdown); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = "```text\n" + dir + "\n├── docs\n│   └── my_guide (v2).md\n└── main.go\n\n2 directories, 2 files\n```\n"
+	if out.String() != want {
+		t.Errorf("Render() as Markdown code block: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+}
+
+func TestGraphOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{`src/say "hi".go`: ""})
+	if err := os.Symlink("src", filepath.Join(dir, "lib")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	tr, err := tree.Build(dir, tree.Options{Rankdir: "lr"})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatDot); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "digraph tree {\n" +
+		"  rankdir=LR;\n" +
+		"  node [fontname=\"monospace\"];\n" +
+		"  n0 [label=\"" + dir + "\", shape=box];\n" +
+		"  n1 [label=\"lib -> src\", shape=box];\n" +
+		"  n0 -> n1 [style=dashed];\n" +
+		"  n2 [label=\"src\", shape=box];\n" +
+		"  n3 [label=\"say \\\"hi\\\".go\", shape=note];\n" +
+		"  n2 -> n3;\n" +
+		"  n0 -> n2;\n" +
+		"}\n"
+	if out.String() != want {
+		t.Errorf("Render() as DOT: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// Mermaid limited to the first level
+	tr.Options.Rankdir = ""
+	tr.Options.GraphDepth = 1
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatMermaid); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = "graph TB\n" +
+		"  n0[\"" + dir + "\"]\n" +
+		"  n1[\"lib -> src\"]\n" +
+		"  n0 -.-> n1\n" +
+		"  n2[\"src\"]\n" +
+		"  n0 --> n2\n"
+	if out.String() != want {
+		t.Errorf("Render() as Mermaid: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	tr.Options.Rankdir = "up"
+	if err := tree.Render(&out, tr, tree.FormatMermaid); err == nil {
+		t.Errorf("Render() with an unknown rankdir should return an error")
+	}
+}
+
+func TestBuildFromList(t *testing.T) {
+	list := "src/main.go\n./README.md\r\nsrc/util/\n.github/workflows/ci.yml\nvendor/lib/lib.go\n\n"
+	tr, err := tree.BuildFromList(strings.NewReader(list), ".", tree.Options{Exclude: "vendor"})
+	if err != nil {
+		t.Fatalf("BuildFromList() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := ".\n├── README.md\n└── src\n    ├── main.go\n    └── util\n\n3 directories, 2 files\n"
+	if out.String() != want {
+		t.Errorf("Render() of a path list: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// NUL separated paths keep their newlines, and -U keeps the listed order
+	list = "b\x00a\nb/c\x00"
+	tr, err = tree.BuildFromList(strings.NewReader(list), "root", tree.Options{Sort: tree.SortNone})
+	if err != nil {
+		t.Fatalf("BuildFromList() returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = "root\n├── b\n└── a\nb\n    └── c\n\n2 directories, 2 files\n"
+	if out.String() != want {
+		t.Errorf("Render() of a NUL separated path list: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+}
+
+func TestReadJSONAndXML(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a&b <c>", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a&b <c>", `"quoted".txt`), []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := tree.Options{Size: true, Permission: true}
+	original, err := tree.Build(dir, opts)
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var text bytes.Buffer
+	if err := tree.Render(&text, original, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+
+	readers := map[string]func(io.Reader, tree.Options) (*tree.Tree, error){
+		tree.FormatJSON: tree.ReadJSON,
+		tree.FormatXML:  tree.ReadXML,
+	}
+	for format, read := range readers {
+		var saved bytes.Buffer
+		if err := tree.Render(&saved, original, format); err != nil {
+			t.Fatalf("Render() as %s returned error: %v", format, err)
+		}
+		tr, err := read(&saved, opts)
+		if err != nil {
+			t.Fatalf("reading %s returned error: %v", format, err)
+		}
+		var out bytes.Buffer
+		if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+			t.Fatalf("Render() returned error: %v", err)
+		}
+		if out.String() != text.String() {
+			t.Errorf("Render() of a tree read from %s: \n output = %s\n expected = %s\n", format, out.String(), text.String())
+		}
+	}
+
+	// errors name the offending entry
+	invalid := map[string]string{
+		`[{"type":"directory","name":"root","contents":[{"type":"directory","name":"src","contents":[{"type":"file"}]}]},{"type":"report","directories":2}]`: `invalid tree entry "root/src/#1": missing name`,
+		`[{"type":"directory","name":"root","contents":[{"type":"file","name":"a","mode":"9"}]},{"type":"report","directories":1}]`:                          `invalid tree entry "root/a": invalid mode "9"`,
+		`[{"type":"directory","name":"root"}]`: `invalid tree: expected the root entry and the report, found 1 elements`,
+	}
+	for doc, want := range invalid {
+		_, err := tree.ReadJSON(strings.NewReader(doc), opts)
+		var importErr *tree.ImportError
+		if !errors.As(err, &importErr) || err.Error() != want {
+			t.Errorf("ReadJSON(%s) error = %v, expected %s", doc, err, want)
+		}
+	}
+	doc := `<tree><directory name="root"><directory name="src"><socket name="s"></socket></directory></directory><report><directories>2</directories></report></tree>`
+	if _, err := tree.ReadXML(strings.NewReader(doc), opts); err == nil || err.Error() != `invalid tree entry "root/src/s": unknown type "socket"` {
+		t.Errorf("ReadXML() error = %v", err)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []struct {
+		name, body, link string
+		mode             int64
+	}{
+		{name: "./pkg/"},
+		{name: "./pkg/cmd/main.go", body: "package main\n", mode: 0755},
+		{name: "./README.md", body: "# readme\n", mode: 0644},
+		{name: "./docs", link: "pkg/cmd", mode: 0777},
+	}
+
+	tarPath := filepath.Join(dir, "release.tar.gz")
+	file, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: e.mode | 0755, Size: int64(len(e.body)), ModTime: mtime, Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			header.Typeflag = tar.TypeDir
+		} else if e.link != "" {
+			header.Typeflag, header.Linkname = tar.TypeSymlink, e.link
+		} else {
+			header.Mode = e.mode
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []io.Closer{tw, gz, file} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// zip archives only hold files, the directories are inferred
+	zipPath := filepath.Join(dir, "release.bin")
+	file, err = os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(file)
+	for _, e := range entries[1:3] {
+		header := &zip.FileHeader{Name: strings.TrimPrefix(e.name, "./"), Modified: mtime}
+		header.SetMode(os.FileMode(e.mode))
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []io.Closer{zw, file} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr, err := tree.Build(tarPath, tree.Options{Size: true, Permission: true})
+	if err != nil {
+		t.Fatalf("Build() of a tar.gz archive returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := tarPath + "\n" +
+		"├── [-rw-r--r--           9] README.md\n" +
+		"├── [Lrwxrwxrwx           0] docs -> pkg/cmd\n" +
+		"└── [drwxr-xr-x           0] pkg\n" +
+		"    └── [drwxr-xr-x           0] cmd\n" +
+		"        └── [-rwxr-xr-x          13] main.go\n" +
+		"\n22 bytes used in 3 directories, 3 files\n"
+	if out.String() != want {
+		t.Errorf("Render() of a tar.gz archive: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// the standard library cannot write bzip2, the same entries are checked in
+	bz2Path := filepath.Join("..", "testdata", "release.tar.bz2")
+	tr, err = tree.Build(bz2Path, tree.Options{Size: true, Permission: true})
+	if err != nil {
+		t.Fatalf("Build() of a tar.bz2 archive returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := bz2Path + strings.TrimPrefix(want, tarPath); out.String() != want {
+		t.Errorf("Render() of a tar.bz2 archive: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// the format is detected from the contents when forced with Archive
+	tr, err = tree.Build(zipPath, tree.Options{Archive: true, Sort: tree.SortMtime})
+	if err != nil {
+		t.Fatalf("Build() of a zip archive returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = zipPath + "\n├── README.md\n└── pkg\n    └── cmd\n        └── main.go\n\n3 directories, 2 files\n"
+	if out.String() != want {
+		t.Errorf("Render() of a zip archive: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// links are colored after their target in the archive, not on the disk
+	t.Setenv("LS_COLORS", "ln=01;36:or=40;31")
+	tr, err = tree.Build(tarPath, tree.Options{Color: true})
+	if err != nil {
+		t.Fatalf("Build() of a tar.gz archive returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := "├── \x1b[01;36mdocs\x1b[0m -> pkg/cmd\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("Render() of a tar.gz archive with color tag: output does not contain %q\n output = %q", want, out.String())
+	}
+}
+
+func TestBuildFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":       {Data: []byte("*.log\n!keep.log\n"), Mode: 0644},
+		"cmd/main.go":      {Data: []byte("package main\n"), Mode: 0755},
+		"cmd/debug.log":    {Data: []byte("debug\n"), Mode: 0644},
+		"cmd/keep.log":     {Data: []byte("keep\n"), Mode: 0644},
+		"docs/guide.md":    {Data: []byte("# guide\n"), Mode: 0644},
+		"docs/.draft.md":   {Data: []byte("draft\n"), Mode: 0644},
+		"vendor/lib/x.go":  {Data: []byte("package lib\n"), Mode: 0644},
+		"assets/logo.png":  {Data: make([]byte, 2048), Mode: 0644},
+		"assets/empty":     {Mode: fs.ModeDir | 0755},
+		"assets/icons/a.x": {Data: []byte("a"), Mode: 0644},
+	}
+
+	tr, err := tree.BuildFS(fsys, "app", tree.Options{GitIgnore: true, Exclude: "vendor", Human: true, DiskUsage: true})
+	if err != nil {
+		t.Fatalf("BuildFS() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "app\n" +
+		"├── [2.0K] assets\n" +
+		"│   ├── [   0] empty\n" +
+		"│   ├── [   1] icons\n" +
+		"│   │   └── [   1] a.x\n" +
+		"│   └── [2.0K] logo.png\n" +
+		"├── [  18] cmd\n" +
+		"│   ├── [   5] keep.log\n" +
+		"│   └── [  13] main.go\n" +
+		"└── [   8] docs\n" +
+		"    └── [   8] guide.md\n" +
+		"\n2.0K used in 6 directories, 5 files\n"
+	if out.String() != want {
+		t.Errorf("Render() of a MapFS: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// a file system without a root directory
+	if _, err := tree.BuildFS(fstest.MapFS{}, "missing", tree.Options{}); err != nil {
+		t.Errorf("BuildFS() of an empty MapFS returned error: %v", err)
+	}
+
+	// links are not followed outside the disk
+	fsys = fstest.MapFS{
+		"a/f":  {Mode: 0644},
+		"a/up": {Data: []byte(".."), Mode: fs.ModeSymlink | 0777},
+	}
+	tr, err = tree.BuildFS(fsys, "app", tree.Options{FollowLinks: true})
+	if err != nil {
+		t.Fatalf("BuildFS() returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = "app\n└── a\n    ├── f\n    └── up -> ..\n\n2 directories, 2 files\n"
+	if out.String() != want {
+		t.Errorf("Render() of a MapFS with links followed: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+}
+
+func TestNonUTF8Names(t *testing.T) {
+	// names are bytes on the disk and in archives, not necessarily UTF-8
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"\xffdir/in/f": ""})
+	want := "\n└── \xffdir\n    └── in\n        └── f\n\n3 directories, 1 files\n"
+
+	tr, err := tree.Build(dir, tree.Options{})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if out.String() != dir+want {
+		t.Errorf("Render() of a directory not named in UTF-8: \n output = %q\n expected = %q\n", out.String(), dir+want)
+	}
+
+	tr, err = tree.BuildFromList(strings.NewReader("\xffdir/in/f\n"), "root", tree.Options{})
+	if err != nil {
+		t.Fatalf("BuildFromList() returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if out.String() != "root"+want {
+		t.Errorf("Render() of a path list not named in UTF-8: \n output = %q\n expected = %q\n", out.String(), "root"+want)
+	}
+}
+
+func TestConcurrentBuild(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 4; j++ {
+			files[fmt.Sprintf("dir%d/sub%d/file.txt", i, j)] = strings.Repeat("x", i*j)
+		}
+	}
+	writeTree(t, dir, files)
+
+	render := func(opts tree.Options) string {
+		tr, err := tree.Build(dir, opts)
+		if err != nil {
+			t.Fatalf("Build() returned error: %v", err)
+		}
+		var out bytes.Buffer
+		if err := tree.Render(&out, tr, tree.FormatJSON); err != nil {
+			t.Fatalf("Render() returned error: %v", err)
+		}
+		return out.String()
+	}
+	for _, opts := range []tree.Options{{}, {DiskUsage: true}, {DiskUsage: true, Level: 2}} {
+		want := render(opts)
+		opts.Jobs = 4
+		for i := 0; i < 5; i++ {
+			if got := render(opts); got != want {
+				t.Fatalf("Build() with %d jobs: \n output = %s\n expected = %s\n", opts.Jobs, got, want)
+			}
+		}
+	}
+}
+
+func TestScanBudgets(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/1.txt": "", "a/2.txt": "", "b/3.txt": "", "c.txt": ""})
+
+	// max entries keeps the first entries in sort order
+	tr, err := tree.Build(dir, tree.Options{MaxEntries: 4})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := dir + "\n├── a\n│   └── 1.txt\n├── b\n└── c.txt\n\n3 directories, 2 files [scan stopped at max entries]\n"
+	if out.String() != want {
+		t.Errorf("Render() with max entries: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// concurrent scans list the same entries
+	large := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 30; j++ {
+			files[fmt.Sprintf("d%d/f%02d", i, j)] = ""
+		}
+	}
+	writeTree(t, large, files)
+	render := func(opts tree.Options) string {
+		tr, err := tree.Build(large, opts)
+		if err != nil {
+			t.Fatalf("Build() returned error: %v", err)
+		}
+		var out bytes.Buffer
+		if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+			t.Fatalf("Render() returned error: %v", err)
+		}
+		return out.String()
+	}
+	want = render(tree.Options{MaxEntries: 100})
+	for i := 0; i < 5; i++ {
+		if got := render(tree.Options{MaxEntries: 100, Jobs: 4}); got != want {
+			t.Fatalf("Render() with max entries and 4 jobs: \n output = %s\n expected = %s\n", got, want)
+		}
+	}
+
+	// only the listed directories count with DirsOnly
+	tr, err = tree.Build(dir, tree.Options{MaxEntries: 2, DirsOnly: true})
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = dir + "\n├── a\n└── b\n\n3 directories\n"
+	if out.String() != want {
+		t.Errorf("Render() with max entries and dirs only: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// a cancelled scan lists nothing below the root
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tr, err = tree.BuildContext(ctx, dir, tree.Options{})
+	if err != nil {
+		t.Fatalf("BuildContext() returned error: %v", err)
+	}
+	expected := internal.TreeSummary{Directories: 1, Truncated: tree.TruncatedInterrupted}
+	if tr.Summary != expected {
+		t.Errorf("BuildContext() cancelled: \n output = %#v\n expected = %#v\n", tr.Summary, expected)
+	}
+
+	// an expired deadline is reported in the structured reports
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	out.Reset()
+	err = tree.DrawContext(ctx, &out, dir, tree.Options{}, tree.FormatJSON)
+	var truncated *tree.TruncatedTreeError
+	if !errors.As(err, &truncated) || truncated.Reason != tree.TruncatedTimeout {
+		t.Errorf("DrawContext() past the deadline: error = %v, expected the scan to time out", err)
+	}
+	if !strings.Contains(out.String(), `"truncated": "timeout"`) {
+		t.Errorf("DrawContext() past the deadline: report not truncated\n%s", out.String())
+	}
+}
+
+// File system failing to open the directories in denied
+type denyFS struct {
+	fstest.MapFS
+	denied map[string]bool
+}
+
+func (fsys denyFS) Open(name string) (fs.File, error) {
+	if fsys.denied[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.MapFS.Open(name)
+}
+
+// File system whose entries in vanished are gone by the time they are
+// read after being listed
+type vanishFS struct {
+	fstest.MapFS
+	vanished map[string]bool
+}
+
+func (fsys vanishFS) Open(name string) (fs.File, error) {
+	if fsys.vanished[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file, err := fsys.MapFS.Open(name)
+	if dir, ok := file.(fs.ReadDirFile); ok {
+		return vanishDir{ReadDirFile: dir, fsys: fsys, name: name}, nil
+	}
+	return file, err
+}
+
+type vanishDir struct {
+	fs.ReadDirFile
+	fsys vanishFS
+	name string
+}
+
+func (dir vanishDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := dir.ReadDirFile.ReadDir(n)
+	for i, entry := range entries {
+		if dir.fsys.vanished[path.Join(dir.name, entry.Name())] {
+			entries[i] = vanishedEntry{entry}
+		}
+	}
+	return entries, err
+}
+
+type vanishedEntry struct {
+	fs.DirEntry
+}
+
+func (vanishedEntry) Info() (fs.FileInfo, error) {
+	return nil, fs.ErrNotExist
+}
+
+func TestEntryErrors(t *testing.T) {
+	fsys := denyFS{
+		MapFS: fstest.MapFS{
+			"private/secret.txt": {Mode: 0644},
+			"public/a/file.txt":  {Mode: 0644},
+			"public/b/file.txt":  {Mode: 0644},
+		},
+		denied: map[string]bool{"private": true, "public/a": true},
+	}
+	tr, err := tree.BuildFS(fsys, "root", tree.Options{})
+	if err != nil {
+		t.Fatalf("BuildFS() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tree.Render(&out, tr, tree.FormatText); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "root\n" +
+		"├── private    [error opening dir: permission denied]\n" +
+		"└── public\n" +
+		"    ├── a    [error opening dir: permission denied]\n" +
+		"    └── b\n" +
+		"        └── file.txt\n" +
+		"\n5 directories, 1 files, 2 errors\n"
+	if out.String() != want {
+		t.Errorf("Render() with unreadable directories: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+	var entryErr *tree.EntryError
+	if err := tr.Root.Children[0].Err; !errors.As(err, &entryErr) || !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("error of the unreadable directory = %#v", err)
+	}
+
+	out.Reset()
+	tr.Options.NoIndent = true
+	if err := tree.Render(&out, tr, tree.FormatJSON); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want = `[{"type":"directory","name":"root","contents":[` +
+		`{"type":"directory","name":"private","error":"opening dir: permission denied"},` +
+		`{"type":"directory","name":"public","contents":[` +
+		`{"type":"directory","name":"a","error":"opening dir: permission denied"},` +
+		`{"type":"directory","name":"b","contents":[{"type":"file","name":"file.txt"}]}]}]},` +
+		`{"type":"report","directories":5,"files":1,"errors":2}]` + "\n"
+	if out.String() != want {
+		t.Errorf("Render() as JSON with unreadable directories: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// errors survive a round trip through the XML output
+	out.Reset()
+	if err := tree.Render(&out, tr, tree.FormatXML); err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	read, err := tree.ReadXML(&out, tree.Options{})
+	if err != nil {
+		t.Fatalf("ReadXML() returned error: %v", err)
+	}
+	if read.Summary.Errors != 2 || read.Root.Children[0].Err == nil || read.Root.Children[0].Err.Error() != "opening dir: permission denied" {
+		t.Errorf("ReadXML() lost the errors: %#v", read.Summary)
+	}
+
+	// a directory gone after it is listed records a single error
+	tr, err = tree.BuildFS(vanishFS{
+		MapFS:    fstest.MapFS{"gone/file.txt": {Mode: 0644}},
+		vanished: map[string]bool{"gone": true},
+	}, "root", tree.Options{})
+	if err != nil {
+		t.Fatalf("BuildFS() returned error: %v", err)
+	}
+	if err := tr.Root.Children[0].Err; tr.Summary.Errors != 1 || err == nil || err.Error() != "reading entry: file does not exist" {
+		t.Errorf("BuildFS() with a vanished directory: errors = %v, error = %v", tr.Summary.Errors, err)
+	}
+}
+
+func TestAccessChecks(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"file.txt": "", "noexec/inner.txt": "", "none/inner.txt": "", "noread/inner.txt": ""})
+	file := filepath.Join(dir, "file.txt")
+
+	// the root reports why it cannot be listed
+	roots := map[string]string{
+		file:                          file + "    [error opening dir: not a directory]\n\n0 directories, 1 files, 1 errors\n",
+		filepath.Join(dir, "missing"): filepath.Join(dir, "missing") + "    [error opening dir: no such file or directory]\n\n0 directories, 0 files, 1 errors\n",
+	}
+	for root, want := range roots {
+		var out bytes.Buffer
+		err := tree.Draw(&out, root, tree.Options{}, tree.FormatText)
+		var partial *tree.PartialTreeError
+		if !errors.As(err, &partial) || partial.Errors != 1 {
+			t.Errorf("Draw() of an invalid root: error = %v, expected the root that could not be read", err)
+		}
+		if out.String() != want {
+			t.Errorf("Draw() of an invalid root: \n output = %s\n expected = %s\n", out.String(), want)
+		}
+	}
+
+	// other formats report the root as an entry with an error
+	var out bytes.Buffer
+	missing := filepath.Join(dir, "missing")
+	if err := tree.Draw(&out, missing, tree.Options{NoIndent: true}, tree.FormatJSON); err == nil {
+		t.Errorf("Draw() of an invalid root as JSON: expected an error")
+	}
+	want := `[{"type":"directory","name":"` + missing + `","error":"opening dir: no such file or directory"},` +
+		`{"type":"report","directories":0,"files":0,"errors":1}]` + "\n"
+	if out.String() != want {
+		t.Errorf("Draw() of an invalid root as JSON: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// directories that are not both readable and searchable cannot be
+	// listed, except by root
+	for name, mode := range map[string]os.FileMode{"noexec": 0644, "none": 0000, "noread": 0311} {
+		if err := os.Chmod(filepath.Join(dir, name), mode); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(filepath.Join(dir, name), 0755)
+	}
+	out.Reset()
+	err := tree.Draw(&out, dir, tree.Options{}, tree.FormatText)
+	if os.Geteuid() == 0 {
+		if err != nil {
+			t.Errorf("Draw() as root returned error: %v", err)
+		}
+		want = dir + "\n├── file.txt\n├── noexec\n│   └── inner.txt\n├── none\n│   └── inner.txt\n└── noread\n    └── inner.txt\n\n4 directories, 4 files\n"
+		if out.String() != want {
+			t.Errorf("Draw() as root with unreadable directories: \n output = %s\n expected = %s\n", out.String(), want)
+		}
+		return
+	}
+	var partial *tree.PartialTreeError
+	if !errors.As(err, &partial) || partial.Errors != 3 {
+		t.Errorf("Draw() error = %v, expected 3 entries that could not be read", err)
+	}
+	want = dir + "\n├── file.txt\n├── noexec    [error opening dir: permission denied]\n├── none    [error opening dir: permission denied]\n└── noread    [error opening dir: permission denied]\n\n4 directories, 1 files, 3 errors\n"
+	if out.String() != want {
+		t.Errorf("Draw() with unreadable directories: \n output = %s\n expected = %s\n", out.String(), want)
+	}
+
+	// streamed entries carry their error on a single line
+	out.Reset()
+	if err := tree.Stream(&out, dir, tree.Options{}); err != nil {
+		t.Fatalf("Stream() returned error: %v", err)
+	}
+	if n := strings.Count(out.String(), `"error":"opening dir: permission denied"`); n != 3 || strings.Contains(out.String(), `"type":"error"`) {
+		t.Errorf("Stream() with unreadable directories: \n output = %s", out.String())
+	}
+}
@@ -0,0 +1,173 @@
+// Package tree builds and renders directory trees like the unix "tree" command.
+package tree
+
+import (
+	"context"
+	_ "embed"
+	"go-tree/internal"
+	"io"
+	"io/fs"
+)
+
+// Options controls how a tree is built and rendered
+type Options = internal.Options
+
+// Tree is a built directory tree along with its summary
+type Tree = internal.Tree
+
+// EntryError is the error of an entry that could not be read, recorded
+// on its node while the scan goes on
+type EntryError = internal.EntryError
+
+// PartialTreeError is returned by Draw after drawing a tree in which
+// some entries could not be read
+type PartialTreeError = internal.PartialTreeError
+
+// TruncatedTreeError is returned by Draw after drawing a tree whose scan
+// stopped before the whole tree was listed
+type TruncatedTreeError = internal.TruncatedTreeError
+
+// ImportError reports the entry of a saved tree that ReadJSON or ReadXML
+// could not read
+type ImportError = internal.ImportError
+
+// Output formats accepted by Render
+const (
+	FormatText     = internal.FormatText
+	FormatJSON     = internal.FormatJSON
+	FormatXML      = internal.FormatXML
+	FormatHTML     = internal.FormatHTML
+	FormatYAML     = internal.FormatYAML
+	FormatTOML     = internal.FormatTOML
+	FormatCSV      = internal.FormatCSV
+	FormatTSV      = internal.FormatTSV
+	FormatMarkdown = internal.FormatMarkdown
+	FormatDot      = internal.FormatDot
+	FormatMermaid  = internal.FormatMermaid
+	// Newline delimited JSON, one object per entry
+	FormatNDJSON = internal.FormatNDJSON
+)
+
+// Sort orders accepted by Options.Sort
+const (
+	SortName      = internal.SortName
+	SortVersion   = internal.SortVersion
+	SortSize      = internal.SortSize
+	SortMtime     = internal.SortMtime
+	SortCtime     = internal.SortCtime
+	SortExtension = internal.SortExtension
+	SortNone      = internal.SortNone
+)
+
+// Reasons reported in the summary of a truncated tree
+const (
+	TruncatedInterrupted = internal.TruncatedInterrupted
+	TruncatedTimeout     = internal.TruncatedTimeout
+	TruncatedMaxEntries  = internal.TruncatedMaxEntries
+)
+
+// Markdown styles accepted by Options.MarkdownStyle
+const (
+	MarkdownCode = internal.MarkdownCode
+	MarkdownList = internal.MarkdownList
+)
+
+// Columns accepted by Options.Columns
+const (
+	ColumnPath  = internal.ColumnPath
+	ColumnName  = internal.ColumnName
+	ColumnDepth = internal.ColumnDepth
+	ColumnType  = internal.ColumnType
+	ColumnSize  = internal.ColumnSize
+	ColumnMode  = internal.ColumnMode
+	ColumnMtime = internal.ColumnMtime
+	ColumnOwner = internal.ColumnOwner
+)
+
+// XMLSchema is the XSD describing the XML output format
+//
+//go:embed tree.xsd
+var XMLSchema string
+
+// Build walks the directory at root and returns its tree. A root zip or
+// tar archive is listed without extracting it.
+func Build(root string, opts Options) (*Tree, error) {
+	return internal.Build(root, opts)
+}
+
+// BuildContext is like Build but stops the scan when ctx is done,
+// returning the tree scanned so far with Summary.Truncated set
+func BuildContext(ctx context.Context, root string, opts Options) (*Tree, error) {
+	return internal.BuildContext(ctx, root, opts)
+}
+
+// BuildFS walks the file system fsys, such as os.DirFS, embed.FS,
+// zip.Reader or fstest.MapFS, and returns its tree with the root named
+// root in the output. Symbolic links are listed but never followed, as
+// links back to an ancestor directory cannot be detected outside the disk.
+func BuildFS(fsys fs.FS, root string, opts Options) (*Tree, error) {
+	return internal.BuildFS(fsys, root, opts)
+}
+
+// BuildFSContext is like BuildFS but stops the scan when ctx is done
+func BuildFSContext(ctx context.Context, fsys fs.FS, root string, opts Options) (*Tree, error) {
+	return internal.BuildFSContext(ctx, fsys, root, opts)
+}
+
+// BuildFromList builds the tree at root from newline or NUL separated
+// paths read from r, without touching the disk
+func BuildFromList(r io.Reader, root string, opts Options) (*Tree, error) {
+	return internal.BuildFromList(r, root, opts)
+}
+
+// ReadJSON reads a tree previously rendered in JSON format
+func ReadJSON(r io.Reader, opts Options) (*Tree, error) {
+	return internal.ReadJSON(r, opts)
+}
+
+// ReadXML reads a tree previously rendered in XML format
+func ReadXML(r io.Reader, opts Options) (*Tree, error) {
+	return internal.ReadXML(r, opts)
+}
+
+// Render writes t to w in the given format
+func Render(w io.Writer, t *Tree, format string) error {
+	return internal.Render(w, t, format)
+}
+
+// ReadDescriptions reads a sidecar file of "path: description" lines for
+// Options.Descriptions
+func ReadDescriptions(path string) (map[string]string, error) {
+	return internal.ReadDescriptions(path)
+}
+
+// Stream writes the entries below root to w as newline delimited JSON
+// while they are discovered, without keeping the tree in memory. With
+// DiskUsage the tree is built first, as directory sizes are only known
+// once their subtree is scanned.
+func Stream(w io.Writer, root string, opts Options) error {
+	return internal.Stream(w, root, opts)
+}
+
+// StreamContext is like Stream but stops the scan when ctx is done
+func StreamContext(ctx context.Context, w io.Writer, root string, opts Options) error {
+	return internal.StreamContext(ctx, w, root, opts)
+}
+
+// AutoColor reports if output written to w should be colorized by
+// default, that is w is a terminal and NO_COLOR is not set
+func AutoColor(w io.Writer) bool {
+	return internal.AutoColor(w)
+}
+
+// Draw builds the tree at root and renders it to w, reporting an
+// unreadable root the same way the tree command does
+func Draw(w io.Writer, root string, opts Options, format string) error {
+	return internal.DrawTree(context.Background(), w, root, opts, format)
+}
+
+// DrawContext is like Draw but stops the scan when ctx is done, drawing
+// the tree scanned so far flagged as truncated
+func DrawContext(ctx context.Context, w io.Writer, root string, opts Options, format string) error {
+	return internal.DrawTree(ctx, w, root, opts, format)
+}